@@ -8,32 +8,54 @@ import (
 // Actor represents a long-running flow that is capable of interacting with
 // the outside world through its inbox and outbox.
 type Actor struct {
+	id     string
 	cancel func()
 	inbox  chan map[string]any
 	outbox chan Result
 }
 
 func NewActor(f func(ctx context.Context, ab *ActorBehavior)) *Actor {
+	return NewActorWithContext(context.Background(), f)
+}
+
+// NewActorWithContext is like NewActor but the context of the actor execution
+// will carry the values of the given parent context. Note that the actor will
+// not be canceled when parent is canceled, and will not record events into the
+// trace of parent, which may have been returned before the actor finishes.
+func NewActorWithContext(parent context.Context, f func(ctx context.Context, ab *ActorBehavior)) *Actor {
 	inbox := make(chan map[string]any)
 	outbox := make(chan Result)
 
 	// Create a new cancellable context for the actor execution.
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ContextWithTrace(context.WithoutCancel(parent), nilTrace{}))
 
 	ab := &ActorBehavior{
 		ctx:    ctx,
 		inbox:  inbox,
 		outbox: outbox,
 	}
-	go f(ctx, ab)
+	metrics := MetricsFromContext(ctx)
+	metrics.ActorStarted()
+	go func() {
+		defer metrics.ActorStopped()
+		f(ctx, ab)
+	}()
 
 	return &Actor{
+		id:     ExecutionIDFromContext(parent),
 		cancel: cancel,
 		inbox:  inbox,
 		outbox: outbox,
 	}
 }
 
+// ID returns the ID of the execution to which the actor belongs, if any (see
+// ContextWithExecutionID). If checkpointing is enabled, the ID can be used to
+// rehydrate the actor after a restart.
+func (a *Actor) ID() string {
+	return a.id
+}
+
 func (a *Actor) Inbox() chan<- map[string]any {
 	return a.inbox
 }
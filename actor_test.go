@@ -0,0 +1,40 @@
+package orchestrator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+func TestNewActorWithContext(t *testing.T) {
+	type key struct{}
+	tr := orchestrator.NewTrace("parent")
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	parent = orchestrator.ContextWithTrace(parent, tr)
+
+	actor := orchestrator.NewActorWithContext(parent, func(ctx context.Context, ab *orchestrator.ActorBehavior) {
+		// Wait until the parent has been canceled.
+		ab.Receive()
+
+		orchestrator.TraceFromContext(ctx).AddEvent("child", nil, nil)
+		ab.Send(orchestrator.Output{
+			"value":    ctx.Value(key{}),
+			"canceled": ctx.Err() != nil,
+		}, nil)
+	})
+
+	cancel()
+	actor.Inbox() <- map[string]any{}
+	result := <-actor.Outbox()
+
+	if result.Output["value"] != "value" {
+		t.Fatalf("Value: Got (%v) != Want (value)", result.Output["value"])
+	}
+	if result.Output["canceled"] != false {
+		t.Fatal("Canceled: Got (true) != Want (false)")
+	}
+	if n := len(tr.Events()); n != 0 {
+		t.Fatalf("Events: Got (%d) != Want (0)", n)
+	}
+}
@@ -0,0 +1,233 @@
+package builtin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+type HTTPAuthType string
+
+const (
+	HTTPAuthBasic                   HTTPAuthType = "basic"
+	HTTPAuthBearer                  HTTPAuthType = "bearer"
+	HTTPAuthOAuth2ClientCredentials HTTPAuthType = "oauth2_client_credentials"
+)
+
+// HTTPAuth is the authentication configuration of an HTTP task. All the
+// fields may contain expressions, which are evaluated against the input
+// environment (e.g. "${secret('API_TOKEN')}").
+type HTTPAuth struct {
+	Type HTTPAuthType `json:"type"`
+
+	// For basic authentication.
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// For bearer authentication, the token is either specified by Token, or
+	// read from the secret named by Secret (see orchestrator.ResolveSecret).
+	Token  string `json:"token"`
+	Secret string `json:"secret"`
+
+	// For OAuth2 client credentials grant (RFC 6749, section 4.4). Tokens
+	// are cached and shared across tasks with the same token URL, client ID,
+	// client secret and scopes, and will be refreshed shortly before they
+	// expire. Only a hash of the client secret is kept in the cache key.
+	TokenURL     string   `json:"token_url"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+}
+
+// apply sets the Authorization header of the request according to the
+// authentication type.
+func (a HTTPAuth) apply(ctx context.Context, client *http.Client, req *http.Request) error {
+	switch a.Type {
+	case "":
+		return nil
+
+	case HTTPAuthBasic:
+		req.SetBasicAuth(a.Username, a.Password)
+		return nil
+
+	case HTTPAuthBearer:
+		token := a.Token
+		if a.Secret != "" {
+			v, err := orchestrator.ResolveSecret(a.Secret)
+			if err != nil {
+				return err
+			}
+			token = v
+		}
+		if token == "" {
+			return fmt.Errorf("bearer token is empty")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+
+	case HTTPAuthOAuth2ClientCredentials:
+		token, err := defaultTokenCache.Token(ctx, client, a)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported auth type %q", a.Type)
+	}
+}
+
+// invalidate discards the cached token, if any, which is typically rejected
+// by the server.
+func (a HTTPAuth) invalidate() {
+	if a.Type == HTTPAuthOAuth2ClientCredentials {
+		defaultTokenCache.Invalidate(a)
+	}
+}
+
+// oauth2ExpiryDelta is how early a token is considered expired, which avoids
+// using tokens that are about to expire in flight.
+const oauth2ExpiryDelta = 10 * time.Second
+
+var defaultTokenCache = &tokenCache{entries: make(map[string]*tokenEntry)}
+
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+
+	expiry time.Time // Zero means no expiration.
+}
+
+// Type returns the token type, which defaults to "Bearer".
+func (t *oauth2Token) Type() string {
+	if strings.EqualFold(t.TokenType, "bearer") || t.TokenType == "" {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+func (t *oauth2Token) valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.expiry.IsZero() || time.Now().Add(oauth2ExpiryDelta).Before(t.expiry)
+}
+
+// tokenCache caches OAuth2 tokens. Concurrent requests for the same token
+// share a single fetch.
+type tokenCache struct {
+	mu      sync.Mutex
+	entries map[string]*tokenEntry
+}
+
+type tokenEntry struct {
+	mu    sync.Mutex
+	token *oauth2Token
+}
+
+func (c *tokenCache) entry(a HTTPAuth) *tokenEntry {
+	scopes := append([]string(nil), a.Scopes...)
+	sort.Strings(scopes)
+	// Include the client secret, so that a wrong secret never gets the token
+	// fetched with the right one.
+	secret := sha256.Sum256([]byte(a.ClientSecret))
+	key := strings.Join([]string{a.TokenURL, a.ClientID, hex.EncodeToString(secret[:]), strings.Join(scopes, " ")}, "\n")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		e = new(tokenEntry)
+		c.entries[key] = e
+	}
+	return e
+}
+
+// Token returns the cached token if it's still valid, otherwise it fetches
+// a new one from the token endpoint.
+func (c *tokenCache) Token(ctx context.Context, client *http.Client, a HTTPAuth) (*oauth2Token, error) {
+	e := c.entry(a)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.token.valid() {
+		return e.token, nil
+	}
+
+	token, err := fetchOAuth2Token(ctx, client, a)
+	if err != nil {
+		return nil, err
+	}
+	e.token = token
+	return token, nil
+}
+
+func (c *tokenCache) Invalidate(a HTTPAuth) {
+	e := c.entry(a)
+	e.mu.Lock()
+	e.token = nil
+	e.mu.Unlock()
+}
+
+func fetchOAuth2Token(ctx context.Context, client *http.Client, a HTTPAuth) (*oauth2Token, error) {
+	if a.TokenURL == "" {
+		return nil, fmt.Errorf("token URL is empty")
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		orchestrator.Log(ctx, err, "oauth2 token request", "url", a.TokenURL, "latency", time.Since(start))
+		return nil, err
+	}
+	defer resp.Body.Close()
+	orchestrator.Log(ctx, nil, "oauth2 token request", "url", a.TokenURL, "status", resp.StatusCode, "latency", time.Since(start))
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to fetch oauth2 token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	token := new(oauth2Token)
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("failed to decode oauth2 token: %v", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("failed to fetch oauth2 token: no access token in response")
+	}
+	if token.ExpiresIn > 0 {
+		token.expiry = start.Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
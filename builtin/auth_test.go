@@ -0,0 +1,184 @@
+package builtin_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	o "github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+func TestHTTP_Auth(t *testing.T) {
+	defer func(p o.SecretProvider) { o.DefaultSecretProvider = p }(o.DefaultSecretProvider)
+	o.DefaultSecretProvider = o.MapSecretProvider{"api_token": "t0ken"}
+
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	newTask := func(auth map[string]any) o.Task {
+		task, err := o.Construct(map[string]any{
+			"name": "test",
+			"type": "http",
+			"input": map[string]any{
+				"method": "GET",
+				"uri":    server.URL,
+				"auth":   auth,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		return task
+	}
+
+	tests := []struct {
+		name     string
+		inInput  map[string]any
+		inTask   o.Task
+		wantAuth string
+		wantErr  string
+	}{
+		{
+			name:     "basic",
+			inInput:  map[string]any{"user": "bob"},
+			inTask:   builtin.NewHTTP("test").Get(server.URL).BasicAuth("${input.user}", "pass").Build(),
+			wantAuth: "Basic Ym9iOnBhc3M=",
+		},
+		{
+			name:     "bearer from expression",
+			inTask:   builtin.NewHTTP("test").Get(server.URL).BearerAuth("${secret('api_token')}").Build(),
+			wantAuth: "Bearer t0ken",
+		},
+		{
+			name:     "bearer from secret",
+			inTask:   newTask(map[string]any{"type": "bearer", "secret": "api_token"}),
+			wantAuth: "Bearer t0ken",
+		},
+		{
+			name:    "missing secret",
+			inTask:  newTask(map[string]any{"type": "bearer", "secret": "unknown"}),
+			wantErr: "failed to authenticate: secret not found: unknown",
+		},
+		{
+			name:    "unsupported type",
+			inTask:  newTask(map[string]any{"type": "digest"}),
+			wantErr: `failed to authenticate: unsupported auth type "digest"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAuth = ""
+			_, err := tt.inTask.Execute(context.Background(), o.NewInput(tt.inInput))
+
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Fatalf("Err: Got (%q) != Want (%q)", gotErr, tt.wantErr)
+			}
+			if gotAuth != tt.wantAuth {
+				t.Fatalf("Authorization: Got (%q) != Want (%q)", gotAuth, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestHTTP_Auth_OAuth2ClientCredentials(t *testing.T) {
+	var fetches atomic.Int32
+	var expiresIn atomic.Int32
+	expiresIn.Store(3600)
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read write" {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+		n := fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, expiresIn.Load())
+	}))
+	defer tokenServer.Close()
+
+	var gotAuth string
+	revoked := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		if revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	newTask := func(clientSecret string) o.Task {
+		return builtin.NewHTTP("test").Get(server.URL).
+			OAuth2ClientCredentials(tokenServer.URL, "client", clientSecret, "read", "write").
+			Build()
+	}
+	execute := func(task o.Task) error {
+		_, err := task.Execute(context.Background(), o.NewInput(nil))
+		return err
+	}
+
+	// The token is fetched once and shared by different tasks.
+	for i := 0; i < 3; i++ {
+		if err := execute(newTask("s3cret")); err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+	}
+	if gotAuth != "Bearer token-1" {
+		t.Fatalf("Authorization: Got (%q) != Want (%q)", gotAuth, "Bearer token-1")
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("Fetches: Got (%d) != Want (%d)", n, 1)
+	}
+
+	// The cached token is not shared with a wrong client secret.
+	wantErr := `failed to authenticate: failed to fetch oauth2 token: 401 Unauthorized: {"error":"invalid_client"}`
+	if err := execute(newTask("bad")); err == nil || err.Error() != wantErr {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, wantErr)
+	}
+
+	// A rejected token will be discarded.
+	revoked = true
+	if err := execute(newTask("s3cret")); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	revoked = false
+	expiresIn.Store(5) // Shorter than the expiry delta.
+	if err := execute(newTask("s3cret")); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if gotAuth != "Bearer token-2" {
+		t.Fatalf("Authorization: Got (%q) != Want (%q)", gotAuth, "Bearer token-2")
+	}
+
+	// A token about to expire will be refreshed.
+	if err := execute(newTask("s3cret")); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if gotAuth != "Bearer token-3" {
+		t.Fatalf("Authorization: Got (%q) != Want (%q)", gotAuth, "Bearer token-3")
+	}
+
+	// Failures of the token endpoint.
+	wantErr = `failed to authenticate: failed to fetch oauth2 token: 401 Unauthorized: {"error":"invalid_client"}`
+	if err := execute(builtin.NewHTTP("test").Get(server.URL).OAuth2ClientCredentials(tokenServer.URL, "other", "bad").Build()); err == nil || err.Error() != wantErr {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, wantErr)
+	}
+}
@@ -58,6 +58,8 @@ func (c *Call) Execute(ctx context.Context, input orchestrator.Input) (orchestra
 	trace := orchestrator.TraceFromContext(ctx).New(c.Name)
 	ctx = orchestrator.ContextWithTrace(ctx, trace)
 
+	ctx = contextWithFlow(ctx, c.Input.Loader, c.Input.Task)
+
 	inputValue := c.Input.Input.Expr.(map[string]any)
 	if !c.Input.Raw {
 		// If in non-raw mode, the input data will be evaluated.
@@ -70,7 +72,7 @@ func (c *Call) Execute(ctx context.Context, input orchestrator.Input) (orchestra
 
 	// Create a new context input since the process will enter a new scope.
 	taskInput := orchestrator.NewInput(inputValue)
-	output, err := trace.Wrap(c.task).Execute(ctx, taskInput)
+	output, err := trace.Wrap(orchestrator.Instrument(c.task)).Execute(ctx, taskInput)
 	if err != nil {
 		return nil, err
 	}
@@ -157,6 +159,18 @@ func (b *CallBuilder) BuildError() (*Call, error) {
 
 // CallFlow loads the given flow from the given loader, and then executes the flow with the given input.
 //
+// If ctx carries no execution ID (see orchestrator.ContextWithExecutionID), a new
+// one will be assigned to the execution.
+//
+// If ctx carries an incoming trace context (see orchestrator.ContextWithTraceContext),
+// all outbound HTTP requests will be made as child spans of it, and will propagate
+// the corresponding traceparent/tracestate headers.
+//
+// If ctx carries a checkpoint store (see orchestrator.ContextWithCheckpointStore),
+// the progress of the execution will be checkpointed, which makes it possible
+// to resume the execution later (see ResumeFlow) if it fails or the process
+// dies. The checkpoint will be deleted once the execution succeeds.
+//
 // Note that CallFlow is a helper for calling flows which use tasks registered in
 // orchestrator.GlobalRegistry. If your case involves tasks registered in a different
 // registry, you need to write your own calling code, in which you need to construct
@@ -166,25 +180,58 @@ func CallFlow(ctx context.Context, loader, name string, input map[string]any) (o
 	if err != nil {
 		return nil, err
 	}
-	return call.Execute(ctx, orchestrator.NewInput(nil))
+
+	ctx, err = contextWithNewCheckpoint(contextWithExecutionID(ctx), loader, name, input)
+	if err != nil {
+		return nil, err
+	}
+	return executeCall(ctx, call)
 }
 
-// TraceFlow behaves like CallFlow but also enables tracing.
-func TraceFlow(ctx context.Context, loader, name string, input map[string]any) (orchestrator.Event, error) {
+// TraceFlow behaves like CallFlow but also enables tracing, which can be tuned
+// by the given options (see orchestrator.TraceTask).
+//
+// Like CallFlow, TraceFlow accepts an incoming trace context carried by ctx.
+// If ctx carries a trace store (see orchestrator.ContextWithTraceStore), the
+// flow's event will be saved into the store.
+func TraceFlow(ctx context.Context, loader, name string, input map[string]any, opts ...orchestrator.TraceOption) (orchestrator.Event, error) {
 	call, err := NewCall("call").Loader(loader).Task(name).Raw().Input(input).BuildError()
 	if err != nil {
 		return orchestrator.Event{}, err
 	}
 
-	event := orchestrator.TraceTask(ctx, call, orchestrator.NewInput(nil))
+	ctx = contextWithFlow(contextWithExecutionID(ctx), loader, name)
+
+	// To be intuitive, trace the flow directly (which is what the call task
+	// does), so as to only expose the flow's single event.
+	event := orchestrator.TraceTask(ctx, call.task, orchestrator.NewInput(input), opts...)
+
+	// Clear the terminated flag since it only works within the flow's scope.
+	// Note that the event may have been saved into the trace store, so clear
+	// the flag on a copy.
+	if orchestrator.Output(event.Output).IsTerminated() {
+		output := make(map[string]any, len(event.Output))
+		for k, v := range event.Output {
+			output[k] = v
+		}
+		orchestrator.Output(output).ClearTerminated()
+		event.Output = output
+	}
+	return event, nil
+}
+
+// contextWithExecutionID assigns a new execution ID to ctx, if there is none.
+func contextWithExecutionID(ctx context.Context) context.Context {
+	if orchestrator.ExecutionIDFromContext(ctx) != "" {
+		return ctx
+	}
+	return orchestrator.ContextWithExecutionID(ctx, orchestrator.NewExecutionID())
+}
 
-	// To be intuitive, only expose the flow's single event.
-	//
-	// call -> flow (serial)
-	//  ^       ^
-	// event   .Events[0]
-	//
-	return event.Events[0], nil
+// contextWithFlow records the identity of the called flow into ctx, which
+// keeps different flows from sharing cached outputs.
+func contextWithFlow(ctx context.Context, loader, name string) context.Context {
+	return orchestrator.ContextWithCacheScope(ctx, loader+"/"+name)
 }
 
 type Loader interface {
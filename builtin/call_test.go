@@ -0,0 +1,197 @@
+package builtin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	o "github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+func TestCallFlow_TraceContext(t *testing.T) {
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	registerLoader(t, "call_trace_context_test", builtin.MapLoader{
+		"flow": map[string]any{
+			"name": "flow",
+			"type": builtin.TypeSerial,
+			"input": map[string]any{
+				"tasks": []map[string]any{
+					{
+						"name": "request",
+						"type": builtin.TypeHTTP,
+						"input": map[string]any{
+							"method": "GET",
+							"uri":    server.URL,
+						},
+					},
+				},
+			},
+		},
+	})
+
+	incoming, err := o.ParseTraceContext("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "congo=t61rcWkgMzE")
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	ctx := o.ContextWithTraceContext(context.Background(), incoming)
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "CallFlow",
+			call: func() error {
+				_, err := builtin.CallFlow(ctx, "call_trace_context_test", "flow", nil)
+				return err
+			},
+		},
+		{
+			name: "TraceFlow",
+			call: func() error {
+				event, err := builtin.TraceFlow(ctx, "call_trace_context_test", "flow", nil)
+				if err != nil {
+					return err
+				}
+				return event.Error
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotHeader = nil
+			if err := tt.call(); err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+
+			got, err := o.TraceContextFromHeader(gotHeader)
+			if err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if got.TraceID != incoming.TraceID {
+				t.Fatalf("TraceID: Got (%x) != Want (%x)", got.TraceID, incoming.TraceID)
+			}
+			if got.SpanID == incoming.SpanID {
+				t.Fatalf("SpanID: Got (%x) == Parent (%x)", got.SpanID, incoming.SpanID)
+			}
+			if got.State != incoming.State {
+				t.Fatalf("State: Got (%q) != Want (%q)", got.State, incoming.State)
+			}
+		})
+	}
+}
+
+func TestTraceFlow(t *testing.T) {
+	registerLoader(t, "trace_flow_test", builtin.MapLoader{
+		"terminated": map[string]any{
+			"name": "terminated",
+			"type": builtin.TypeSerial,
+			"input": map[string]any{
+				"tasks": []map[string]any{
+					{
+						"name": "end",
+						"type": builtin.TypeTerminate,
+						"input": map[string]any{
+							"output": map[string]any{"done": true},
+						},
+					},
+				},
+			},
+		},
+		"untraced": map[string]any{
+			"name":          "untraced",
+			"type":          builtin.TypeSerial,
+			"disable_trace": true,
+			"input": map[string]any{
+				"tasks": []map[string]any{
+					{
+						"name": "end",
+						"type": builtin.TypeTerminate,
+						"input": map[string]any{
+							"output": map[string]any{"done": true},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	store := o.NewMemoryTraceStore()
+	ctx := o.ContextWithTraceStore(o.ContextWithExecutionID(context.Background(), "1"), store)
+
+	event, err := builtin.TraceFlow(ctx, "trace_flow_test", "terminated", nil)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if o.Output(event.Output).IsTerminated() || event.Output["done"] != true {
+		t.Fatalf("Output: Got (%v) != Want (map[done:true])", event.Output)
+	}
+	// The saved event is left intact.
+	record, err := store.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if !o.Output(record.Event.Output).IsTerminated() {
+		t.Fatalf("Output: Got (%v) != Want (terminated)", record.Event.Output)
+	}
+
+	// The flow opts out of tracing.
+	event, err = builtin.TraceFlow(context.Background(), "trace_flow_test", "untraced", nil)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if event.Name != "untraced" || len(event.Events) != 0 || event.Output["done"] != true {
+		t.Fatalf("Event: Got (%+v)", event)
+	}
+}
+
+func TestCallFlow_Cache(t *testing.T) {
+	newLoader := func(name string) builtin.MapLoader {
+		return builtin.MapLoader{
+			"flow": map[string]any{
+				"name": "flow",
+				"type": builtin.TypeFunc,
+				"cache": map[string]any{
+					"key": "key",
+				},
+				"input": map[string]any{
+					"func": func(context.Context, o.Input) (o.Output, error) {
+						return o.Output{"loader": name}, nil
+					},
+				},
+			},
+		}
+	}
+	registerLoader(t, "call_cache_test_1", newLoader("call_cache_test_1"))
+	registerLoader(t, "call_cache_test_2", newLoader("call_cache_test_2"))
+
+	// Flows of the same name from different loaders never share cached outputs.
+	ctx := o.ContextWithCache(context.Background(), o.NewLRUCache(10))
+	for _, loader := range []string{"call_cache_test_1", "call_cache_test_2", "call_cache_test_1"} {
+		output, err := builtin.CallFlow(ctx, loader, "flow", nil)
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		if output["loader"] != loader {
+			t.Fatalf("Output: Got (%v) != Want (%v)", output["loader"], loader)
+		}
+	}
+}
+
+// registerLoader registers loader globally for the duration of the test.
+func registerLoader(t *testing.T, name string, loader builtin.Loader) {
+	builtin.LoaderRegistry.MustRegister(name, loader)
+	t.Cleanup(func() {
+		delete(builtin.LoaderRegistry, name)
+	})
+}
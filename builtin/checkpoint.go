@@ -0,0 +1,85 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+// ResumeFlow resumes the execution of the given ID, which was started by
+// CallFlow, from its checkpoint saved in the checkpoint store carried by ctx.
+// Completed tasks will be skipped and their recorded outputs will be used
+// instead, while the remaining tasks will be executed as usual.
+func ResumeFlow(ctx context.Context, executionID string) (orchestrator.Output, error) {
+	store := orchestrator.CheckpointStoreFromContext(ctx)
+	if store == nil {
+		return nil, fmt.Errorf("no checkpoint store found in context")
+	}
+
+	cp, err := store.Get(ctx, executionID)
+	if err != nil {
+		return nil, err
+	}
+
+	call, err := NewCall("call").Loader(cp.Loader).Task(cp.Flow).Raw().Input(cp.Input).BuildError()
+	if err != nil {
+		return nil, err
+	}
+
+	return executeCall(orchestrator.ContextWithCheckpoint(ctx, cp), call)
+}
+
+// ResumeActor rehydrates the actor of the given execution ID, which was
+// started by CallFlow (with an asynchronous flow) and then paused at a Wait
+// task, from its checkpoint saved in the checkpoint store carried by ctx.
+// Typically, it's used after a restart to deliver the next inbox message to
+// the actor. Note that the output sent by the Wait task before pausing will
+// not be sent again.
+func ResumeActor(ctx context.Context, executionID string) (*orchestrator.Actor, error) {
+	output, err := ResumeFlow(ctx, executionID)
+	if err != nil {
+		return nil, err
+	}
+	actor, ok := output.Actor()
+	if !ok {
+		return nil, fmt.Errorf("execution %q is not an actor", executionID)
+	}
+	return actor, nil
+}
+
+// contextWithNewCheckpoint creates a checkpoint for the execution, if ctx
+// carries a checkpoint store.
+func contextWithNewCheckpoint(ctx context.Context, loader, name string, input map[string]any) (context.Context, error) {
+	store := orchestrator.CheckpointStoreFromContext(ctx)
+	if store == nil {
+		return ctx, nil
+	}
+
+	cp := orchestrator.Checkpoint{
+		ExecutionID: orchestrator.ExecutionIDFromContext(ctx),
+		Loader:      loader,
+		Flow:        name,
+		Input:       input,
+	}
+	if err := store.Create(ctx, cp); err != nil {
+		return nil, err
+	}
+	return orchestrator.ContextWithCheckpoint(ctx, cp), nil
+}
+
+// executeCall executes the call task, and deletes the checkpoint, if any, once
+// the execution succeeds.
+func executeCall(ctx context.Context, call *Call) (orchestrator.Output, error) {
+	output, err := call.Execute(ctx, orchestrator.NewInput(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	// If the flow is asynchronous, the checkpoint will be completed by the
+	// actor once it finishes.
+	if _, ok := output.Actor(); !ok {
+		orchestrator.CompleteCheckpoint(ctx)
+	}
+	return output, nil
+}
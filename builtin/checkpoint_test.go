@@ -0,0 +1,236 @@
+package builtin_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResumeFlow(t *testing.T) {
+	var creates, fetches int
+	var checked []any
+	failing := true
+
+	newFunc := func(name string, f func(orchestrator.Input) (orchestrator.Output, error)) map[string]any {
+		return map[string]any{
+			"name": name,
+			"type": builtin.TypeFunc,
+			"input": map[string]any{
+				"func": func(_ context.Context, input orchestrator.Input) (orchestrator.Output, error) {
+					return f(input)
+				},
+			},
+		}
+	}
+	flow := map[string]any{
+		"name": "flow",
+		"type": builtin.TypeSerial,
+		"input": map[string]any{
+			"tasks": []map[string]any{
+				newFunc("create", func(orchestrator.Input) (orchestrator.Output, error) {
+					creates++
+					return orchestrator.Output{"id": 42}, nil
+				}),
+				{
+					"name": "loop",
+					"type": builtin.TypeLoop,
+					"input": map[string]any{
+						"iterator": map[string]any{
+							"name": "iter",
+							"type": builtin.TypeIterate,
+							"input": map[string]any{
+								"type":  "list",
+								"value": []any{1, 2, 3},
+							},
+						},
+						"body": map[string]any{
+							"name": "body",
+							"type": builtin.TypeSerial,
+							"input": map[string]any{
+								"tasks": []map[string]any{
+									newFunc("fetch", func(input orchestrator.Input) (orchestrator.Output, error) {
+										fetches++
+										return orchestrator.Output{"value": input.Get("iter")["value"]}, nil
+									}),
+									newFunc("check", func(input orchestrator.Input) (orchestrator.Output, error) {
+										checked = append(checked, input.Get("fetch")["value"])
+										if failing && input.Get("fetch")["value"] == 2 {
+											return nil, errors.New("oops")
+										}
+										return orchestrator.Output{}, nil
+									}),
+								},
+							},
+						},
+					},
+				},
+				newFunc("finish", func(input orchestrator.Input) (orchestrator.Output, error) {
+					return orchestrator.Output{"id": input.Get("create")["id"]}, nil
+				}),
+			},
+		},
+	}
+	registerLoader(t, "checkpoint_test", builtin.MapLoader{"flow": flow})
+
+	path := filepath.Join(t.TempDir(), "checkpoints.jsonl")
+	fileStore, err := orchestrator.NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	// The file holds unredacted outputs.
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Fatalf("Mode: Got (%v) != Want (%v)", mode, os.FileMode(0o600))
+	}
+
+	for i, store := range []orchestrator.CheckpointStore{orchestrator.NewMemoryCheckpointStore(), fileStore} {
+		creates, fetches, checked, failing = 0, 0, nil, true
+		id := fmt.Sprintf("exec-%d", i)
+		ctx := orchestrator.ContextWithExecutionID(orchestrator.ContextWithCheckpointStore(context.Background(), store), id)
+
+		if _, err := builtin.CallFlow(ctx, "checkpoint_test", "flow", nil); err == nil {
+			t.Fatalf("Err: Got (nil) != Want (oops)")
+		}
+
+		if fs, ok := store.(*orchestrator.FileCheckpointStore); ok {
+			// Simulate a restart.
+			if err := fs.Close(); err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if store, err = orchestrator.NewFileCheckpointStore(path); err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			ctx = orchestrator.ContextWithCheckpointStore(context.Background(), store)
+		}
+
+		failing, checked = false, nil
+		output, err := builtin.ResumeFlow(ctx, id)
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+
+		// The restored outputs keep their types.
+		if got := output["id"]; got != 42 {
+			t.Fatalf("Output: Got (%#v) != Want (42)", got)
+		}
+		// The 1st check will not be repeated, while the 2nd one sees the
+		// restored output of the 2nd fetch, just like the original run.
+		if want := []any{2, 3}; !cmp.Equal(checked, want) {
+			t.Fatalf("Checked: Got (%#v) != Want (%#v)", checked, want)
+		}
+		if creates != 1 {
+			t.Fatalf("Creates: Got (%d) != Want (1)", creates)
+		}
+		// The 1st and 2nd fetches will not be repeated.
+		if fetches != 3 {
+			t.Fatalf("Fetches: Got (%d) != Want (3)", fetches)
+		}
+		if _, err := store.Get(ctx, id); !errors.Is(err, orchestrator.ErrCheckpointNotFound) {
+			t.Fatalf("Err: Got (%v) != Want (%v)", err, orchestrator.ErrCheckpointNotFound)
+		}
+	}
+}
+
+func TestResumeActor(t *testing.T) {
+	var greets int
+	flow := map[string]any{
+		"name": "flow",
+		"type": builtin.TypeSerial,
+		"input": map[string]any{
+			"async": true,
+			"tasks": []map[string]any{
+				{
+					"name": "greet",
+					"type": builtin.TypeFunc,
+					"input": map[string]any{
+						"func": func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+							greets++
+							return orchestrator.Output{"greeting": "hello"}, nil
+						},
+					},
+				},
+				{
+					"name": "ask",
+					"type": builtin.TypeWait,
+					"input": map[string]any{
+						"output": map[string]any{"question": "what's your name?"},
+					},
+				},
+				{
+					"name": "reply",
+					"type": builtin.TypeCode,
+					"input": map[string]any{
+						"code": `
+def _(env):
+    return env.greet.greeting + ", " + env.ask.input.name
+`,
+					},
+				},
+			},
+		},
+	}
+	registerLoader(t, "actor_checkpoint_test", builtin.MapLoader{"flow": flow})
+
+	path := filepath.Join(t.TempDir(), "checkpoints.jsonl")
+	store, err := orchestrator.NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	ctx := orchestrator.ContextWithCheckpointStore(context.Background(), store)
+
+	output, err := builtin.CallFlow(ctx, "actor_checkpoint_test", "flow", nil)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	actor, _ := output.Actor()
+	if result := <-actor.Outbox(); result.Output["status"] != "pause" {
+		t.Fatalf("Status: Got (%v) != Want (pause)", result.Output["status"])
+	}
+
+	// Simulate a restart.
+	actor.Stop()
+	if err := store.Close(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if store, err = orchestrator.NewFileCheckpointStore(path); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	ctx = orchestrator.ContextWithCheckpointStore(context.Background(), store)
+
+	cp, err := store.Get(ctx, actor.ID())
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if key, _, ok := cp.Paused(); !ok || key != "flow/ask" {
+		t.Fatalf("Paused: Got (%q, %v) != Want (%q, true)", key, ok, "flow/ask")
+	}
+
+	actor, err = builtin.ResumeActor(ctx, actor.ID())
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	actor.Inbox() <- map[string]any{"name": "bob"}
+	result := <-actor.Outbox()
+	if result.Err != nil {
+		t.Fatalf("Err: %v", result.Err)
+	}
+	if got := result.Output["result"]; got != "hello, bob" {
+		t.Fatalf("Result: Got (%v) != Want (hello, bob)", got)
+	}
+	if greets != 1 {
+		t.Fatalf("Greets: Got (%d) != Want (1)", greets)
+	}
+	if _, err := store.Get(ctx, actor.ID()); !errors.Is(err, orchestrator.ErrCheckpointNotFound) {
+		t.Fatalf("Err: Got (%v) != Want (%v)", err, orchestrator.ErrCheckpointNotFound)
+	}
+}
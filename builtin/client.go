@@ -0,0 +1,73 @@
+package builtin
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+// HTTPClientOptions are the per-task settings of the HTTP client, which
+// override those of the connection profile.
+type HTTPClientOptions struct {
+	// Client is the name of the connection profile (see
+	// orchestrator.Registry.SetHTTPClientFactory). Empty means the default one.
+	Client string `json:"client"`
+	// InsecureSkipVerify disables the verification of server certificates.
+	// It requires the transport of the profile to be an *http.Transport, which
+	// will be cloned (i.e. the connection pool will not be shared).
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+	// MaxRedirects is the maximum number of redirects to follow. Zero means
+	// not to follow redirects, in which case the redirect response will be
+	// returned as is. Nil means to use the policy of the profile.
+	MaxRedirects *int `json:"max_redirects"`
+}
+
+// newHTTPClient creates an HTTP client from the registry r with the given
+// options and timeout.
+func newHTTPClient(r *orchestrator.Registry, opts HTTPClientOptions, timeout time.Duration) (*http.Client, error) {
+	c, err := r.HTTPClient(opts.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make a copy to keep the original client intact.
+	client := *c
+	if timeout > 0 {
+		client.Timeout = timeout
+	}
+
+	if opts.InsecureSkipVerify {
+		rt := client.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("insecure_skip_verify requires an *http.Transport, but got %T", rt)
+		}
+		t = t.Clone()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = new(tls.Config)
+		}
+		t.TLSClientConfig.InsecureSkipVerify = true // #nosec G402
+		client.Transport = t
+	}
+
+	if opts.MaxRedirects != nil {
+		max := *opts.MaxRedirects
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if max <= 0 {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > max {
+				return fmt.Errorf("stopped after %d redirects", max)
+			}
+			return nil
+		}
+	}
+
+	return &client, nil
+}
@@ -0,0 +1,469 @@
+package builtin
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Codec interface {
+	Decode(in io.Reader, out any) error
+	Encode(in any) (out io.Reader, err error)
+}
+
+// ContentTyper is implemented by codecs that know the content type of the
+// data they encode.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// NewCodec creates a codec for the given encoding, which is one of "json",
+// "form", "multipart", "text" and "xml".
+func NewCodec(encoding string) (Codec, error) {
+	switch encoding {
+	case "json":
+		return JSON{}, nil
+	case "form":
+		return Form{}, nil
+	case "multipart":
+		return NewMultipart(), nil
+	case "text":
+		return Text{}, nil
+	case "xml":
+		return XML{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// codecForMediaType returns the codec for decoding content of the given media
+// type, if supported.
+func codecForMediaType(mediatype string) (Codec, bool) {
+	switch {
+	case mediatype == "application/json" || strings.HasSuffix(mediatype, "+json"):
+		return JSON{}, true
+	case mediatype == "application/xml" || mediatype == "text/xml" || strings.HasSuffix(mediatype, "+xml"):
+		return XML{}, true
+	case mediatype == "application/x-www-form-urlencoded":
+		return Form{}, true
+	default:
+		return nil, false
+	}
+}
+
+type JSON struct{}
+
+func (j JSON) Decode(in io.Reader, out any) error {
+	return json.NewDecoder(in).Decode(out)
+}
+
+func (j JSON) Encode(in any) (io.Reader, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(data), nil
+}
+
+func (j JSON) ContentType() string { return "application/json" }
+
+// Form is a codec for URL-encoded forms (i.e. application/x-www-form-urlencoded).
+//
+// When encoding, the input must be a map, whose values are either scalars or
+// slices of scalars (i.e. multiple values). When decoding, a field with a
+// single value becomes a string, otherwise it becomes a slice of strings.
+type Form struct{}
+
+func (f Form) Decode(in io.Reader, out any) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	m := make(map[string]any, len(values))
+	for k, v := range values {
+		if len(v) == 1 {
+			m[k] = v[0]
+			continue
+		}
+		var list []any
+		for _, vv := range v {
+			list = append(list, vv)
+		}
+		m[k] = list
+	}
+	return assign(out, m)
+}
+
+func (f Form) Encode(in any) (io.Reader, error) {
+	m, ok := in.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("form body must be a map, but got %T", in)
+	}
+
+	values := url.Values{}
+	for k, v := range m {
+		if list, ok := v.([]any); ok {
+			for _, vv := range list {
+				values.Add(k, fmt.Sprintf("%v", vv))
+			}
+			continue
+		}
+		values.Add(k, fmt.Sprintf("%v", v))
+	}
+	return strings.NewReader(values.Encode()), nil
+}
+
+func (f Form) ContentType() string { return "application/x-www-form-urlencoded" }
+
+// Multipart is a codec for multipart forms (i.e. multipart/form-data), which
+// only supports encoding.
+//
+// The input must be a map. A value which is a map with a "filename" field is
+// a file, whose content is either specified by the "content" field (a string)
+// or read from the file at the "path" field (see MultipartBaseDir). The
+// content type of a file
+// defaults to "application/octet-stream", and can be specified by the
+// "content_type" field. All the other values are normal fields.
+type Multipart struct {
+	boundary string
+}
+
+func NewMultipart() Multipart {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return Multipart{boundary: hex.EncodeToString(b[:])}
+}
+
+func (m Multipart) Decode(in io.Reader, out any) error {
+	return fmt.Errorf("decoding multipart content is not supported")
+}
+
+func (m Multipart) Encode(in any) (io.Reader, error) {
+	fields, ok := in.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("multipart body must be a map, but got %T", in)
+	}
+
+	// Sort the field names to get a predictable payload.
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.SetBoundary(m.boundary); err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		value := fields[name]
+		file, ok := value.(map[string]any)
+		if !ok || file["filename"] == nil {
+			if err := w.WriteField(name, fmt.Sprintf("%v", value)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		content, err := fileContent(file)
+		if err != nil {
+			return nil, err
+		}
+		contentType, _ := file["content_type"].(string)
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, name, fmt.Sprintf("%v", file["filename"])))
+		h.Set("Content-Type", contentType)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func (m Multipart) ContentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// MultipartBaseDir is the directory from which the files of multipart bodies
+// can be read by path. Relative paths are resolved against it, and paths that
+// resolve outside of it (including through symbolic links) are rejected.
+// Empty means reading files by path is disabled, which is the default since
+// the paths may come from untrusted input.
+var MultipartBaseDir string
+
+func fileContent(file map[string]any) ([]byte, error) {
+	switch content := file["content"].(type) {
+	case string:
+		return []byte(content), nil
+	case []byte:
+		return content, nil
+	}
+	if path, ok := file["path"].(string); ok && path != "" {
+		resolved, err := resolveMultipartPath(path)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(resolved)
+	}
+	return nil, fmt.Errorf("file %v has neither content nor path", file["filename"])
+}
+
+// resolveMultipartPath resolves the given path against MultipartBaseDir.
+func resolveMultipartPath(path string) (string, error) {
+	if MultipartBaseDir == "" {
+		return "", fmt.Errorf("reading file %q is not allowed: no multipart base directory configured", path)
+	}
+
+	base, err := filepath.Abs(MultipartBaseDir)
+	if err != nil {
+		return "", err
+	}
+	if base, err = filepath.EvalSymlinks(base); err != nil {
+		return "", err
+	}
+
+	resolved := path
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(base, resolved)
+	}
+	// Check the path both before and after following symbolic links, so as
+	// not to even probe the files outside of the base directory.
+	if isWithinDir(base, resolved) {
+		resolved, err = filepath.EvalSymlinks(resolved)
+		if err != nil {
+			return "", err
+		}
+	}
+	if !isWithinDir(base, resolved) {
+		return "", fmt.Errorf("reading file %q is not allowed: outside of the multipart base directory", path)
+	}
+	return resolved, nil
+}
+
+// isWithinDir reports whether path is dir itself or lies under dir.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Text is a codec for plain text. When encoding, a string or a byte slice is
+// sent as is, while any other value is formatted as a string.
+type Text struct{}
+
+func (t Text) Decode(in io.Reader, out any) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	return assign(out, string(data))
+}
+
+func (t Text) Encode(in any) (io.Reader, error) {
+	switch v := in.(type) {
+	case string:
+		return strings.NewReader(v), nil
+	case []byte:
+		return bytes.NewReader(v), nil
+	default:
+		return strings.NewReader(fmt.Sprintf("%v", v)), nil
+	}
+}
+
+func (t Text) ContentType() string { return "text/plain; charset=utf-8" }
+
+// XML is a codec for XML, which converts between XML documents and maps:
+//
+//   - The document becomes a map with a single key, i.e. the root element.
+//   - An element with neither attributes nor child elements becomes a string.
+//   - Otherwise, an element becomes a map, in which attributes are prefixed
+//     with "@", the text content (if any) is keyed by "#text", and repeated
+//     child elements become a slice.
+//
+// For example, `<user id="1"><name>bob</name></user>` is converted to
+// {"user": {"@id": "1", "name": "bob"}}.
+type XML struct{}
+
+func (x XML) Decode(in io.Reader, out any) error {
+	d := xml.NewDecoder(in)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("no root element found in XML")
+			}
+			return err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			value, err := decodeXMLElement(d, start)
+			if err != nil {
+				return err
+			}
+			return assign(out, map[string]any{start.Name.Local: value})
+		}
+	}
+}
+
+func decodeXMLElement(d *xml.Decoder, start xml.StartElement) (any, error) {
+	m := make(map[string]any)
+	for _, attr := range start.Attr {
+		m["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	hasChildren := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			hasChildren = true
+			value, err := decodeXMLElement(d, t)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			switch existing := m[name].(type) {
+			case nil:
+				m[name] = value
+			case []any:
+				m[name] = append(existing, value)
+			default:
+				m[name] = []any{existing, value}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if !hasChildren && len(start.Attr) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				m["#text"] = s
+			}
+			return m, nil
+		}
+	}
+}
+
+func (x XML) Encode(in any) (io.Reader, error) {
+	m, ok := in.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, fmt.Errorf("XML body must be a map with exactly one root element")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	e := xml.NewEncoder(&buf)
+	for name, value := range m {
+		if err := encodeXMLElement(e, name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func (x XML) ContentType() string { return "application/xml" }
+
+func encodeXMLElement(e *xml.Encoder, name string, value any) error {
+	// Repeated elements.
+	if list, ok := value.([]any); ok {
+		for _, v := range list {
+			if err := encodeXMLElement(e, name, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	m, ok := value.(map[string]any)
+	if !ok {
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		if value != nil {
+			if err := e.EncodeToken(xml.CharData(fmt.Sprintf("%v", value))); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	}
+
+	// Sort the keys to get a predictable document.
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if attr, ok := strings.CutPrefix(k, "@"); ok {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attr}, Value: fmt.Sprintf("%v", m[k])})
+		}
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if text, ok := m["#text"]; ok {
+		if err := e.EncodeToken(xml.CharData(fmt.Sprintf("%v", text))); err != nil {
+			return err
+		}
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(k, "@") || k == "#text" {
+			continue
+		}
+		if err := encodeXMLElement(e, k, m[k]); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// assign sets the value pointed to by out, which must be of type *any.
+func assign(out any, value any) error {
+	p, ok := out.(*any)
+	if !ok {
+		return fmt.Errorf("out must be of type *any, but got %T", out)
+	}
+	*p = value
+	return nil
+}
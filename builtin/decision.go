@@ -64,15 +64,19 @@ func (d *Decision) Execute(ctx context.Context, input orchestrator.Input) (orche
 		return nil, err
 	}
 
-	task, ok := d.Input.Cases[d.Input.Expression.Value]
+	value := d.Input.Expression.Value
+	task, ok := d.Input.Cases[value]
 	if !ok {
 		if d.Input.Default != nil {
-			return trace.Wrap(d.Input.Default).Execute(ctx, input)
+			orchestrator.Log(ctx, nil, "decision made", "value", value, "branch", "default", "task", d.Input.Default.Header().Name)
+			return trace.Wrap(orchestrator.Instrument(d.Input.Default)).Execute(ctx, input)
 		}
+		orchestrator.Log(ctx, nil, "decision made", "value", value, "branch", "none")
 		return nil, nil
 	}
 
-	return trace.Wrap(task).Execute(ctx, input)
+	orchestrator.Log(ctx, nil, "decision made", "value", value, "branch", "case", "task", task.Header().Name)
+	return trace.Wrap(orchestrator.Instrument(task)).Execute(ctx, input)
 }
 
 type DecisionBuilder struct {
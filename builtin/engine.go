@@ -0,0 +1,372 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+type ExecutionStatus string
+
+const (
+	ExecutionRunning   ExecutionStatus = "running"
+	ExecutionPaused    ExecutionStatus = "paused"
+	ExecutionSucceeded ExecutionStatus = "succeeded"
+	ExecutionFailed    ExecutionStatus = "failed"
+	ExecutionCancelled ExecutionStatus = "cancelled"
+)
+
+// Done reports whether the status is a final one.
+func (s ExecutionStatus) Done() bool {
+	switch s {
+	case ExecutionSucceeded, ExecutionFailed, ExecutionCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// Execution is a snapshot of an execution managed by Engine.
+type Execution struct {
+	ID     string          `json:"id"`
+	Loader string          `json:"loader"`
+	Flow   string          `json:"flow"`
+	Status ExecutionStatus `json:"status"`
+	Start  time.Time       `json:"start"`
+	// End is zero if the execution has not finished yet.
+	End time.Time `json:"end"`
+	// CurrentTask is the name of the task being executed, if any.
+	CurrentTask string `json:"current_task,omitempty"`
+	// Output is the final output of the execution. For an asynchronous flow,
+	// it's also the latest output sent by the actor (e.g. by a Wait task).
+	Output orchestrator.Output `json:"output,omitempty"`
+	Error  error               `json:"error,omitempty"`
+}
+
+// Engine starts flows asynchronously and keeps track of their executions,
+// including the actors of asynchronous flows.
+//
+// Engine uses CallFlow to execute flows, so the context passed to Start can
+// carry the values that CallFlow accepts (e.g. a checkpoint store).
+type Engine struct {
+	mu         sync.RWMutex
+	executions map[string]*execution
+}
+
+func NewEngine() *Engine {
+	return &Engine{
+		executions: make(map[string]*execution),
+	}
+}
+
+type execution struct {
+	mu     sync.RWMutex
+	info   Execution
+	tasks  []string // The names of the running tasks, in starting order.
+	actor  *orchestrator.Actor
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start starts executing the given flow, loaded from the given loader, with
+// the given input in the background. It returns the execution ID, which is
+// either carried by ctx (see orchestrator.ContextWithExecutionID) or newly
+// assigned.
+//
+// The execution will be cancelled if ctx is cancelled.
+func (e *Engine) Start(ctx context.Context, loader, name string, input map[string]any) (string, error) {
+	ctx = contextWithExecutionID(ctx)
+	return e.run(ctx, loader, name, func(ctx context.Context) (orchestrator.Output, error) {
+		return CallFlow(ctx, loader, name, input)
+	})
+}
+
+// Resume resumes the execution of the given ID in the background from its
+// checkpoint, which is saved in the checkpoint store carried by ctx (see
+// ResumeFlow). This is typically used to take over the unfinished executions,
+// including paused actors, after a restart.
+func (e *Engine) Resume(ctx context.Context, executionID string) error {
+	store := orchestrator.CheckpointStoreFromContext(ctx)
+	if store == nil {
+		return fmt.Errorf("no checkpoint store found in context")
+	}
+	cp, err := store.Get(ctx, executionID)
+	if err != nil {
+		return err
+	}
+
+	ctx = orchestrator.ContextWithExecutionID(ctx, executionID)
+	_, err = e.run(ctx, cp.Loader, cp.Flow, func(ctx context.Context) (orchestrator.Output, error) {
+		return ResumeFlow(ctx, executionID)
+	})
+	return err
+}
+
+func (e *Engine) run(ctx context.Context, loader, name string, f func(context.Context) (orchestrator.Output, error)) (string, error) {
+	id := orchestrator.ExecutionIDFromContext(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	x := &execution{
+		info: Execution{
+			ID:     id,
+			Loader: loader,
+			Flow:   name,
+			Status: ExecutionRunning,
+			Start:  time.Now(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	e.mu.Lock()
+	if old, ok := e.executions[id]; ok && !old.snapshot().Status.Done() {
+		e.mu.Unlock()
+		cancel()
+		return "", fmt.Errorf("execution %q is already running", id)
+	}
+	e.executions[id] = x
+	e.mu.Unlock()
+
+	// Keep track of the current task.
+	ctx = orchestrator.ContextWithMetrics(ctx, &executionMetrics{
+		Metrics: orchestrator.MetricsFromContext(ctx),
+		x:       x,
+	})
+
+	go func() {
+		output, err := f(ctx)
+		if err != nil {
+			x.finish(ctx, nil, err)
+			return
+		}
+
+		actor, ok := output.Actor()
+		if !ok {
+			x.finish(ctx, output, nil)
+			return
+		}
+
+		x.mu.Lock()
+		x.actor = actor
+		x.mu.Unlock()
+		x.watch(ctx, actor)
+	}()
+
+	return id, nil
+}
+
+// Status returns the snapshot of the execution of the given ID.
+func (e *Engine) Status(executionID string) (Execution, error) {
+	x, err := e.get(executionID)
+	if err != nil {
+		return Execution{}, err
+	}
+	return x.snapshot(), nil
+}
+
+// List returns the snapshots of the executions with the given statuses,
+// ordered by their start times. If no status is specified, all the active
+// (i.e. running or paused) executions will be returned.
+func (e *Engine) List(statuses ...ExecutionStatus) []Execution {
+	if len(statuses) == 0 {
+		statuses = []ExecutionStatus{ExecutionRunning, ExecutionPaused}
+	}
+	wanted := make(map[ExecutionStatus]bool)
+	for _, s := range statuses {
+		wanted[s] = true
+	}
+
+	e.mu.RLock()
+	var list []Execution
+	for _, x := range e.executions {
+		if info := x.snapshot(); wanted[info.Status] {
+			list = append(list, info)
+		}
+	}
+	e.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Start.Before(list[j].Start)
+	})
+	return list
+}
+
+// Cancel cancels the execution of the given ID, including its actor if any.
+func (e *Engine) Cancel(executionID string) error {
+	x, err := e.get(executionID)
+	if err != nil {
+		return err
+	}
+	if x.snapshot().Status.Done() {
+		return fmt.Errorf("execution %q has already finished", executionID)
+	}
+	x.cancel()
+	return nil
+}
+
+// Send sends the given input to the actor of the execution of the given ID.
+// It blocks until the actor receives the input, or ctx is done.
+func (e *Engine) Send(ctx context.Context, executionID string, input map[string]any) error {
+	x, err := e.get(executionID)
+	if err != nil {
+		return err
+	}
+
+	x.mu.RLock()
+	actor := x.actor
+	x.mu.RUnlock()
+	if actor == nil {
+		return fmt.Errorf("execution %q has no actor", executionID)
+	}
+
+	select {
+	case actor.Inbox() <- input:
+		x.update(func(info *Execution) {
+			if info.Status == ExecutionPaused {
+				info.Status = ExecutionRunning
+			}
+		})
+		return nil
+	case <-x.done:
+		return fmt.Errorf("execution %q has already finished", executionID)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait blocks until the execution of the given ID finishes, or ctx is done.
+func (e *Engine) Wait(ctx context.Context, executionID string) (Execution, error) {
+	x, err := e.get(executionID)
+	if err != nil {
+		return Execution{}, err
+	}
+	select {
+	case <-x.done:
+		return x.snapshot(), nil
+	case <-ctx.Done():
+		return Execution{}, ctx.Err()
+	}
+}
+
+// Remove removes the finished execution of the given ID from the engine.
+func (e *Engine) Remove(executionID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	x, ok := e.executions[executionID]
+	if !ok {
+		return fmt.Errorf("execution %q is not found", executionID)
+	}
+	if !x.snapshot().Status.Done() {
+		return fmt.Errorf("execution %q has not finished yet", executionID)
+	}
+	delete(e.executions, executionID)
+	return nil
+}
+
+func (e *Engine) get(executionID string) (*execution, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	x, ok := e.executions[executionID]
+	if !ok {
+		return nil, fmt.Errorf("execution %q is not found", executionID)
+	}
+	return x, nil
+}
+
+func (x *execution) snapshot() Execution {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	info := x.info
+	if n := len(x.tasks); n > 0 {
+		info.CurrentTask = x.tasks[n-1]
+	}
+	return info
+}
+
+func (x *execution) update(f func(info *Execution)) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	f(&x.info)
+}
+
+// watch keeps track of the actor until it finishes or the execution is cancelled.
+func (x *execution) watch(ctx context.Context, actor *orchestrator.Actor) {
+	for {
+		select {
+		case result := <-actor.Outbox():
+			if result.Err != nil {
+				x.finish(ctx, nil, result.Err)
+				return
+			}
+			switch result.Output["status"] {
+			case "pause":
+				x.update(func(info *Execution) {
+					info.Status = ExecutionPaused
+					info.Output = result.Output
+				})
+			case "finish":
+				x.finish(ctx, result.Output, nil)
+				return
+			default:
+				x.update(func(info *Execution) { info.Output = result.Output })
+			}
+		case <-ctx.Done():
+			actor.Stop()
+			x.finish(ctx, nil, ctx.Err())
+			return
+		}
+	}
+}
+
+func (x *execution) finish(ctx context.Context, output orchestrator.Output, err error) {
+	x.update(func(info *Execution) {
+		info.End = time.Now()
+		info.Output = output
+		info.Error = err
+		switch {
+		case err == nil:
+			info.Status = ExecutionSucceeded
+		case errors.Is(err, context.Canceled) || ctx.Err() != nil:
+			info.Status = ExecutionCancelled
+		default:
+			info.Status = ExecutionFailed
+		}
+	})
+	x.cancel()
+	close(x.done)
+}
+
+// executionMetrics keeps track of the running tasks of an execution, while
+// still reporting to the original metrics.
+type executionMetrics struct {
+	orchestrator.Metrics
+	x *execution
+}
+
+func (m *executionMetrics) TaskStarted(header orchestrator.TaskHeader) {
+	m.x.mu.Lock()
+	m.x.tasks = append(m.x.tasks, header.Name)
+	m.x.mu.Unlock()
+
+	m.Metrics.TaskStarted(header)
+}
+
+func (m *executionMetrics) TaskFinished(header orchestrator.TaskHeader, elapsed time.Duration, err error) {
+	m.x.mu.Lock()
+	for i := len(m.x.tasks) - 1; i >= 0; i-- {
+		if m.x.tasks[i] == header.Name {
+			m.x.tasks = append(m.x.tasks[:i], m.x.tasks[i+1:]...)
+			break
+		}
+	}
+	m.x.mu.Unlock()
+
+	m.Metrics.TaskFinished(header, elapsed, err)
+}
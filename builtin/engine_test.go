@@ -0,0 +1,134 @@
+package builtin_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+func TestEngine(t *testing.T) {
+	release := make(chan struct{})
+	newFunc := func(name string, f func(context.Context) (orchestrator.Output, error)) map[string]any {
+		return map[string]any{
+			"name": name,
+			"type": builtin.TypeFunc,
+			"input": map[string]any{
+				"func": func(ctx context.Context, _ orchestrator.Input) (orchestrator.Output, error) {
+					return f(ctx)
+				},
+			},
+		}
+	}
+	registerLoader(t, "engine_test", builtin.MapLoader{
+		"blocking": map[string]any{
+			"name": "blocking",
+			"type": builtin.TypeSerial,
+			"input": map[string]any{
+				"tasks": []map[string]any{
+					newFunc("block", func(ctx context.Context) (orchestrator.Output, error) {
+						select {
+						case <-release:
+							return orchestrator.Output{"done": true}, nil
+						case <-ctx.Done():
+							return nil, ctx.Err()
+						}
+					}),
+				},
+			},
+		},
+		"actor": map[string]any{
+			"name": "actor",
+			"type": builtin.TypeSerial,
+			"input": map[string]any{
+				"async": true,
+				"tasks": []map[string]any{
+					{
+						"name": "ask",
+						"type": builtin.TypeWait,
+						"input": map[string]any{
+							"output": map[string]any{"question": "name?"},
+						},
+					},
+					newFunc("reply", func(context.Context) (orchestrator.Output, error) {
+						return orchestrator.Output{"reply": "ok"}, nil
+					}),
+				},
+			},
+		},
+	})
+
+	ctx := context.Background()
+	engine := builtin.NewEngine()
+
+	waitFor := func(id string, status builtin.ExecutionStatus) builtin.Execution {
+		for i := 0; i < 100; i++ {
+			x, err := engine.Status(id)
+			if err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if x.Status == status {
+				return x
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Status: never became %s", status)
+		return builtin.Execution{}
+	}
+
+	// Succeeded.
+	id1, err := engine.Start(ctx, "engine_test", "blocking", nil)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	// Cancelled.
+	id2, err := engine.Start(ctx, "engine_test", "blocking", nil)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	// Actor.
+	id3, err := engine.Start(ctx, "engine_test", "actor", nil)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	if x := waitFor(id3, builtin.ExecutionPaused); x.CurrentTask != "ask" {
+		t.Fatalf("CurrentTask: Got (%s) != Want (ask)", x.CurrentTask)
+	}
+	if x := waitFor(id1, builtin.ExecutionRunning); x.CurrentTask != "block" {
+		t.Fatalf("CurrentTask: Got (%s) != Want (block)", x.CurrentTask)
+	}
+	if n := len(engine.List()); n != 3 {
+		t.Fatalf("Active: Got (%d) != Want (3)", n)
+	}
+
+	if err := engine.Cancel(id2); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if x, _ := engine.Wait(ctx, id2); x.Status != builtin.ExecutionCancelled {
+		t.Fatalf("Status: Got (%s) != Want (%s)", x.Status, builtin.ExecutionCancelled)
+	}
+
+	close(release)
+	x, _ := engine.Wait(ctx, id1)
+	if x.Status != builtin.ExecutionSucceeded || x.Output["done"] != true || x.End.IsZero() {
+		t.Fatalf("Execution: Got (%+v)", x)
+	}
+
+	if err := engine.Send(ctx, id3, map[string]any{"name": "bob"}); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	x, _ = engine.Wait(ctx, id3)
+	if x.Status != builtin.ExecutionSucceeded || x.Output["reply"] != "ok" {
+		t.Fatalf("Execution: Got (%+v)", x)
+	}
+
+	if n := len(engine.List()); n != 0 {
+		t.Fatalf("Active: Got (%d) != Want (0)", n)
+	}
+	if n := len(engine.List(builtin.ExecutionSucceeded)); n != 2 {
+		t.Fatalf("Succeeded: Got (%d) != Want (2)", n)
+	}
+}
@@ -28,7 +28,7 @@ type Func struct {
 
 	Input struct {
 		Func func(context.Context, orchestrator.Input) (orchestrator.Output, error) `json:"func"`
-	} `json:input`
+	} `json:"input"`
 }
 
 func (f *Func) String() string {
@@ -0,0 +1,270 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+const (
+	TypeGraphQL = "graphql"
+)
+
+func init() {
+	MustRegisterGraphQL(orchestrator.GlobalRegistry)
+}
+
+func MustRegisterGraphQL(r *orchestrator.Registry) {
+	r.MustRegister(&orchestrator.TaskFactory{
+		Type: TypeGraphQL,
+		New:  func() orchestrator.Task { return new(GraphQL) },
+	})
+}
+
+// GraphQLError is returned by a GraphQL task when the response contains
+// a non-empty "errors" array. It carries the partial data, if any, so that
+// the error can be inspected by using errors.As.
+type GraphQLError struct {
+	Errors []GraphQLErrorDetail `json:"errors"`
+	Data   map[string]any       `json:"data"`
+}
+
+// GraphQLErrorDetail is an error in the "errors" array of a GraphQL response.
+type GraphQLErrorDetail struct {
+	Message   string            `json:"message"`
+	Locations []GraphQLLocation `json:"locations"`
+	// Path is the path of the response field which experienced the error,
+	// whose elements are field names (strings) or list indices (integers).
+	Path       []any          `json:"path"`
+	Extensions map[string]any `json:"extensions"`
+}
+
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e *GraphQLError) Error() string {
+	var msgs []string
+	for _, d := range e.Errors {
+		msg := d.Message
+		if len(d.Path) > 0 {
+			var path []string
+			for _, p := range d.Path {
+				path = append(path, fmt.Sprintf("%v", p))
+			}
+			msg = fmt.Sprintf("%s (path: %s)", msg, strings.Join(path, "."))
+		}
+		msgs = append(msgs, msg)
+	}
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+// Output returns the errors and the partial data as an output.
+func (e *GraphQLError) Output() orchestrator.Output {
+	var errs []any
+	_ = orchestrator.DefaultCodec.Decode(e.Errors, &errs)
+	return orchestrator.Output{
+		"errors": errs,
+		"data":   e.Data,
+	}
+}
+
+// GraphQL is a leaf task that is used to make GraphQL calls over HTTP.
+//
+// The request is sent as a POST with a JSON body of the form {"query": ...,
+// "variables": ..., "operationName": ...}, by using the same client, auth and
+// timeout handling as the HTTP task. The output is the unwrapped "data" of
+// the response.
+type GraphQL struct {
+	orchestrator.TaskHeader
+
+	Input struct {
+		URI    orchestrator.Expr[string]              `json:"uri"`
+		Header orchestrator.Expr[map[string][]string] `json:"header"`
+		Auth   orchestrator.Expr[HTTPAuth]            `json:"auth"`
+		// Query is the GraphQL document, which is sent as is (i.e. it is not
+		// an expression).
+		Query string `json:"query"`
+		// Variables are the values of the variables defined in Query.
+		Variables orchestrator.Expr[map[string]any] `json:"variables"`
+		// OperationName is the name of the operation to execute, which is only
+		// required if Query contains multiple operations.
+		OperationName    string `json:"operation_name"`
+		MaxResponseBytes int64  `json:"max_response_bytes"`
+
+		HTTPClientOptions
+	} `json:"input"`
+
+	http *HTTP
+}
+
+func (g *GraphQL) Init(r *orchestrator.Registry) error {
+	if strings.TrimSpace(g.Input.Query) == "" {
+		return fmt.Errorf("query is required")
+	}
+	g.http = &HTTP{
+		TaskHeader: g.TaskHeader,
+		Input: HTTPInput{
+			Method:            orchestrator.Expr[string]{Expr: "POST"},
+			URI:               g.Input.URI,
+			Header:            g.Input.Header,
+			Auth:              g.Input.Auth,
+			MaxResponseBytes:  g.Input.MaxResponseBytes,
+			HTTPClientOptions: g.Input.HTTPClientOptions,
+		},
+	}
+	return g.http.Init(r)
+}
+
+func (g *GraphQL) String() string {
+	return orchestrator.Redact(fmt.Sprintf(
+		"%s(name:%s, timeout:%s, uri:%v, operation:%s)",
+		g.Type,
+		g.Name,
+		g.Timeout,
+		g.Input.URI.Expr,
+		g.Input.OperationName,
+	))
+}
+
+func (g *GraphQL) Execute(ctx context.Context, input orchestrator.Input) (orchestrator.Output, error) {
+	variables, err := g.Input.Variables.EvaluateX(input)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]any{"query": g.Input.Query}
+	if len(variables) > 0 {
+		body["variables"] = variables
+	}
+	if g.Input.OperationName != "" {
+		body["operationName"] = g.Input.OperationName
+	}
+
+	// The body has been evaluated, and must not be evaluated again, since the
+	// variables may contain untrusted strings that look like expressions.
+	req, auth, err := g.http.newRequestWithBody(ctx, input, body)
+	if err != nil {
+		return nil, err
+	}
+	output, err := g.http.do(ctx, req, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	status, _ := output["status"].(int)
+	header, _ := output["header"].(http.Header)
+	failed := status < 200 || status > 299
+
+	resp, ok := output["body"].(map[string]any)
+	if !ok {
+		if failed {
+			return nil, &HTTPError{Status: status, Header: header, Body: output["body"]}
+		}
+		return nil, fmt.Errorf("bad graphql response: %T", output["body"])
+	}
+
+	data, _ := resp["data"].(map[string]any)
+	if errs, _ := resp["errors"].([]any); len(errs) > 0 {
+		e := &GraphQLError{Data: data}
+		if err := orchestrator.DefaultCodec.Decode(errs, &e.Errors); err != nil {
+			return nil, fmt.Errorf("bad graphql errors: %v", err)
+		}
+		return nil, e
+	}
+	if failed {
+		// Not a GraphQL error (e.g. from a gateway).
+		return nil, &HTTPError{Status: status, Header: header, Body: resp}
+	}
+
+	return data, nil
+}
+
+type GraphQLBuilder struct {
+	task *GraphQL
+}
+
+func NewGraphQL(name string) *GraphQLBuilder {
+	task := &GraphQL{
+		TaskHeader: orchestrator.TaskHeader{
+			Name: name,
+			Type: TypeGraphQL,
+		},
+	}
+	return &GraphQLBuilder{task: task}
+}
+
+func (b *GraphQLBuilder) Timeout(timeout time.Duration) *GraphQLBuilder {
+	b.task.Timeout = timeout
+	return b
+}
+
+// Endpoint sets the URI of the GraphQL endpoint.
+func (b *GraphQLBuilder) Endpoint(uri string) *GraphQLBuilder {
+	b.task.Input.URI = orchestrator.Expr[string]{Expr: uri}
+	return b
+}
+
+func (b *GraphQLBuilder) Header(key string, values ...string) *GraphQLBuilder {
+	if b.task.Input.Header.Expr == nil {
+		b.task.Input.Header = orchestrator.Expr[map[string][]string]{Expr: make(map[string][]string)}
+	}
+	b.task.Input.Header.Expr.(map[string][]string)[key] = values
+	return b
+}
+
+// Query sets the GraphQL document.
+func (b *GraphQLBuilder) Query(query string) *GraphQLBuilder {
+	b.task.Input.Query = query
+	return b
+}
+
+// Variables sets the variables, which can be a map or an expression.
+func (b *GraphQLBuilder) Variables(variables any) *GraphQLBuilder {
+	b.task.Input.Variables = orchestrator.Expr[map[string]any]{Expr: variables}
+	return b
+}
+
+func (b *GraphQLBuilder) OperationName(name string) *GraphQLBuilder {
+	b.task.Input.OperationName = name
+	return b
+}
+
+// BasicAuth sets the username and password for HTTP Basic authentication.
+func (b *GraphQLBuilder) BasicAuth(username, password string) *GraphQLBuilder {
+	b.task.Input.Auth = orchestrator.Expr[HTTPAuth]{Expr: map[string]any{
+		"type":     string(HTTPAuthBasic),
+		"username": username,
+		"password": password,
+	}}
+	return b
+}
+
+// BearerAuth sets the bearer token, which may be an expression
+// (e.g. "${secret('API_TOKEN')}").
+func (b *GraphQLBuilder) BearerAuth(token string) *GraphQLBuilder {
+	b.task.Input.Auth = orchestrator.Expr[HTTPAuth]{Expr: map[string]any{
+		"type":  string(HTTPAuthBearer),
+		"token": token,
+	}}
+	return b
+}
+
+// Client sets the name of the connection profile, which is registered in
+// orchestrator.GlobalRegistry.
+func (b *GraphQLBuilder) Client(name string) *GraphQLBuilder {
+	b.task.Input.Client = name
+	return b
+}
+
+func (b *GraphQLBuilder) Build() orchestrator.Task {
+	if err := b.task.Init(orchestrator.GlobalRegistry); err != nil {
+		panic(err)
+	}
+	return b.task
+}
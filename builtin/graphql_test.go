@@ -0,0 +1,169 @@
+package builtin_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	o "github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGraphQL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Query         string         `json:"query"`
+			Variables     map[string]any `json:"variables"`
+			OperationName string         `json:"operationName"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/graphql-response+json")
+		switch id := req.Variables["id"]; {
+		case req.OperationName != "GetUser":
+			_, _ = w.Write([]byte(`{"errors": [{"message": "unknown operation", "locations": [{"line": 1, "column": 1}]}]}`))
+		case id == "0":
+			_, _ = w.Write([]byte(`{"data": {"user": null}, "errors": [{"message": "user not found", "path": ["user"]}]}`))
+		case id == "502":
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("bad gateway"))
+		default:
+			_, _ = fmt.Fprintf(w, `{"data": {"user": {"id": %q, "name": "foo"}}}`, id)
+		}
+	}))
+	defer server.Close()
+
+	newTask := func(operationName string) o.Task {
+		task, err := o.ConstructFromYAML([]byte(fmt.Sprintf(`
+name: get_user
+type: graphql
+input:
+  uri: %s
+  auth:
+    type: bearer
+    token: token
+  query: |
+    query GetUser($id: ID!) {
+      user(id: $id) { id name }
+    }
+  variables: ${input.variables}
+  operation_name: %s
+`, server.URL, operationName)))
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		return task
+	}
+
+	tests := []struct {
+		name       string
+		inTask     o.Task
+		inID       string
+		wantOutput o.Output
+		wantErr    error
+	}{
+		{
+			name:       "data",
+			inTask:     newTask("GetUser"),
+			inID:       "1",
+			wantOutput: o.Output{"user": map[string]any{"id": "1", "name": "foo"}},
+		},
+		{
+			name: "builder",
+			inTask: builtin.NewGraphQL("get_user").
+				Endpoint(server.URL).
+				BearerAuth("token").
+				Query(`query GetUser($id: ID!) { user(id: $id) { id name } }`).
+				Variables(map[string]any{"id": "${input.variables.id}"}).
+				OperationName("GetUser").
+				Build(),
+			inID:       "2",
+			wantOutput: o.Output{"user": map[string]any{"id": "2", "name": "foo"}},
+		},
+		{
+			name:   "errors with partial data",
+			inTask: newTask("GetUser"),
+			inID:   "0",
+			wantErr: &builtin.GraphQLError{
+				Errors: []builtin.GraphQLErrorDetail{{Message: "user not found", Path: []any{"user"}}},
+				Data:   map[string]any{"user": nil},
+			},
+		},
+		{
+			name:   "errors",
+			inTask: newTask("Other"),
+			inID:   "1",
+			wantErr: &builtin.GraphQLError{
+				Errors: []builtin.GraphQLErrorDetail{{Message: "unknown operation", Locations: []builtin.GraphQLLocation{{Line: 1, Column: 1}}}},
+			},
+		},
+		{
+			name:    "bad gateway",
+			inTask:  newTask("GetUser"),
+			inID:    "502",
+			wantErr: &builtin.HTTPError{Status: http.StatusBadGateway, Body: "bad gateway"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := o.NewInput(map[string]any{"variables": map[string]any{"id": tt.inID}})
+			output, err := tt.inTask.Execute(context.Background(), input)
+
+			switch wantErr := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("Err: %v", err)
+				}
+				if !cmp.Equal(output, tt.wantOutput) {
+					t.Fatalf("Diff: %v", cmp.Diff(output, tt.wantOutput))
+				}
+			case *builtin.GraphQLError:
+				var gotErr *builtin.GraphQLError
+				if !errors.As(err, &gotErr) {
+					t.Fatalf("Err: Got (%v) != Want (%v)", err, wantErr)
+				}
+				if !cmp.Equal(gotErr, wantErr) {
+					t.Fatalf("Diff: %v", cmp.Diff(gotErr, wantErr))
+				}
+			case *builtin.HTTPError:
+				var gotErr *builtin.HTTPError
+				if !errors.As(err, &gotErr) {
+					t.Fatalf("Err: Got (%v) != Want (%v)", err, wantErr)
+				}
+				if gotErr.Status != wantErr.Status || gotErr.Body != wantErr.Body {
+					t.Fatalf("Err: Got (%v) != Want (%v)", gotErr, wantErr)
+				}
+			}
+		})
+	}
+
+	wantErr := `graphql: user not found (path: user)`
+	if _, err := newTask("GetUser").Execute(context.Background(), o.NewInput(map[string]any{"variables": map[string]any{"id": "0"}})); err == nil || err.Error() != wantErr {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, wantErr)
+	}
+
+	// Bad input.
+	_, err := o.Construct(map[string]any{
+		"name":  "test",
+		"type":  "graphql",
+		"input": map[string]any{"uri": server.URL},
+	})
+	if err == nil || err.Error() != "query is required" {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, "query is required")
+	}
+}
@@ -3,11 +3,11 @@ package builtin
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/RussellLuo/orchestrator"
@@ -29,57 +29,77 @@ func MustRegisterHTTP(r *orchestrator.Registry) {
 	})
 }
 
-type Codec interface {
-	Decode(in io.Reader, out any) error
-	Encode(in any) (out io.Reader, err error)
-}
+// HTTP is a leaf task that is used to make calls to another service over HTTP.
+type HTTP struct {
+	orchestrator.TaskHeader
 
-func NewCodec(encoding string) (Codec, error) {
-	switch encoding {
-	case "json":
-		return JSON{}, nil
-	default:
-		return nil, fmt.Errorf("unsupported encoding %q", encoding)
-	}
-}
+	Input HTTPInput `json:"input"`
 
-type JSON struct{}
+	client       *http.Client
+	codec        Codec
+	expectStatus statusMatcher
+}
 
-func (j JSON) Decode(in io.Reader, out any) error {
-	return json.NewDecoder(in).Decode(out)
+// HTTPInput is the input of an HTTP task.
+type HTTPInput struct {
+	Encoding string                                 `json:"encoding"`
+	Method   orchestrator.Expr[string]              `json:"method"`
+	URI      orchestrator.Expr[string]              `json:"uri"`
+	Query    orchestrator.Expr[map[string]any]      `json:"query"`
+	Header   orchestrator.Expr[map[string][]string] `json:"header"`
+	// Body can be any value, which will be encoded according to Encoding.
+	Body orchestrator.Expr[any] `json:"body"`
+	// If RawBody is true, Body must be a string, a byte slice or an io.Reader
+	// (e.g. the body of an HTTP task in the reader response mode), which will
+	// be sent as is (e.g. a payload that has been serialized by a Code task).
+	RawBody bool `json:"raw_body"`
+	// Auth sets the Authorization header (see HTTPAuth).
+	Auth orchestrator.Expr[HTTPAuth] `json:"auth"`
+	// ExpectStatus is a list of the expected status codes, each of which
+	// can be a status code (e.g. 200), a class (e.g. "2xx") or a range
+	// (e.g. "200-299"). An unexpected status will result in an *HTTPError.
+	// Empty means that any status is expected.
+	ExpectStatus []any `json:"expect_status"`
+	// MaxResponseBytes is the maximum size of a non-streamed response body.
+	// A larger body will result in an ErrResponseTooLarge, while the body of
+	// an unexpected status will be truncated. Zero means no limit.
+	MaxResponseBytes int64 `json:"max_response_bytes"`
+	// ResponseMode determines how a non-streamed response body is made into
+	// the output (see ResponseMode). It defaults to "decode".
+	ResponseMode ResponseMode `json:"response_mode"`
+
+	HTTPClientOptions
+	// A filter expression for extracting fields from a server-sent event.
+	SSEFilter string `json:"sse_filter"`
+	// SSE is the options for consuming server-sent events.
+	SSE SSEOptions `json:"sse"`
+	// Stream is the options for handling the events of a streamed response.
+	Stream StreamOptions `json:"stream"`
 }
 
-func (j JSON) Encode(in any) (io.Reader, error) {
-	data, err := json.Marshal(in)
+func (h *HTTP) Init(r *orchestrator.Registry) error {
+	client, err := newHTTPClient(r, h.Input.HTTPClientOptions, h.Timeout)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return bytes.NewBuffer(data), nil
-}
-
-// HTTP is a leaf task that is used to make calls to another service over HTTP.
-type HTTP struct {
-	orchestrator.TaskHeader
+	h.client = client
 
-	Input struct {
-		Encoding string                                 `json:"encoding"`
-		Method   orchestrator.Expr[string]              `json:"method"`
-		URI      orchestrator.Expr[string]              `json:"uri"`
-		Query    orchestrator.Expr[map[string]any]      `json:"query"`
-		Header   orchestrator.Expr[map[string][]string] `json:"header"`
-		Body     orchestrator.Expr[map[string]any]      `json:"body"`
-		// A filter expression for extracting fields from a server-sent event.
-		SSEFilter string `json:"sse_filter"`
-	} `json:"input"`
-
-	client *http.Client
-	codec  Codec
-}
+	if h.Input.Encoding == "" {
+		h.Input.Encoding = "json"
+	}
+	h.codec, err = NewCodec(h.Input.Encoding)
+	if err != nil {
+		return err
+	}
 
-func (h *HTTP) Init(r *orchestrator.Registry) error {
-	h.client = &http.Client{Timeout: h.Timeout}
-	h.Encoding(h.Input.Encoding)
-	return nil
+	h.expectStatus, err = parseStatusMatcher(h.Input.ExpectStatus)
+	if err != nil {
+		return err
+	}
+	if err := h.Input.ResponseMode.validate(); err != nil {
+		return err
+	}
+	return h.Input.Stream.validate()
 }
 
 func (h *HTTP) Encoding(encoding string) *HTTP {
@@ -98,19 +118,49 @@ func (h *HTTP) Encoding(encoding string) *HTTP {
 }
 
 func (h *HTTP) getEncodingHeader() map[string][]string {
+	header := make(map[string][]string)
+	if ct, ok := h.codec.(ContentTyper); ok {
+		header["Content-Type"] = []string{ct.ContentType()}
+	}
 	switch h.Input.Encoding {
 	case "json":
-		return map[string][]string{
-			"Content-Type": {"application/json"},
-			"Accept":       {"application/json"},
+		header["Accept"] = []string{"application/json"}
+	case "xml":
+		header["Accept"] = []string{"application/xml"}
+	}
+	return header
+}
+
+func (h *HTTP) encodeBody(body any) (io.Reader, error) {
+	switch v := body.(type) {
+	case nil:
+		return nil, nil
+	case map[string]any:
+		// For backwards compatibility, an empty map means no body.
+		if len(v) == 0 {
+			return nil, nil
 		}
+	}
+
+	if !h.Input.RawBody {
+		return h.codec.Encode(body)
+	}
+
+	switch v := body.(type) {
+	case string:
+		return strings.NewReader(v), nil
+	case []byte:
+		return bytes.NewReader(v), nil
+	case io.Reader:
+		// E.g. the body of a previous HTTP task in the reader mode.
+		return v, nil
 	default:
-		return nil
+		return nil, fmt.Errorf("raw body must be a string, bytes or a reader, but got %T", v)
 	}
 }
 
 func (h *HTTP) String() string {
-	return fmt.Sprintf(
+	return orchestrator.Redact(fmt.Sprintf(
 		"%s(name:%s, timeout:%s, request:%s %v, header:%v, body:%v)",
 		h.Type,
 		h.Name,
@@ -119,111 +169,136 @@ func (h *HTTP) String() string {
 		h.Input.URI.Expr,
 		h.Input.Header.Expr,
 		h.Input.Body.Expr,
-	)
+	))
 }
 
 func (h *HTTP) Execute(ctx context.Context, input orchestrator.Input) (orchestrator.Output, error) {
-	if err := h.Input.Method.Evaluate(input); err != nil {
+	req, auth, err := h.newRequest(ctx, input)
+	if err != nil {
 		return nil, err
 	}
-	if err := h.Input.URI.Evaluate(input); err != nil {
-		return nil, err
+	return h.do(ctx, req, auth)
+}
+
+// newRequest makes an authenticated request from the input.
+func (h *HTTP) newRequest(ctx context.Context, input orchestrator.Input) (*http.Request, HTTPAuth, error) {
+	// Evaluate into fresh values, since the task may be executed repeatedly
+	// (or concurrently) with different inputs.
+	body, err := h.Input.Body.EvaluateX(input)
+	if err != nil {
+		return nil, HTTPAuth{}, err
 	}
-	if err := h.Input.Query.Evaluate(input); err != nil {
-		return nil, err
+	return h.newRequestWithBody(ctx, input, body)
+}
+
+// newRequestWithBody is like newRequest, but uses the given body (which will
+// not be evaluated) instead of the one from the input.
+func (h *HTTP) newRequestWithBody(ctx context.Context, input orchestrator.Input, body any) (*http.Request, HTTPAuth, error) {
+	method, err := h.Input.Method.EvaluateX(input)
+	if err != nil {
+		return nil, HTTPAuth{}, err
 	}
-	if err := h.Input.Header.Evaluate(input); err != nil {
-		return nil, err
+	uri, err := h.Input.URI.EvaluateX(input)
+	if err != nil {
+		return nil, HTTPAuth{}, err
 	}
-	if err := h.Input.Body.Evaluate(input); err != nil {
-		return nil, err
+	query, err := h.Input.Query.EvaluateX(input)
+	if err != nil {
+		return nil, HTTPAuth{}, err
+	}
+	header, err := h.Input.Header.EvaluateX(input)
+	if err != nil {
+		return nil, HTTPAuth{}, err
+	}
+	auth, err := h.Input.Auth.EvaluateX(input)
+	if err != nil {
+		return nil, HTTPAuth{}, err
 	}
 
-	var body io.Reader
-	if len(h.Input.Body.Value) > 0 {
-		out, err := h.codec.Encode(h.Input.Body.Value)
-		if err != nil {
-			return nil, err
-		}
-		body = out
+	reader, err := h.encodeBody(body)
+	if err != nil {
+		return nil, HTTPAuth{}, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, h.Input.Method.Value, h.Input.URI.Value, body)
+	req, err := http.NewRequestWithContext(ctx, method, uri, reader)
 	if err != nil {
-		return nil, err
+		return nil, HTTPAuth{}, err
 	}
 
 	q := req.URL.Query()
-	for key, value := range h.Input.Query.Value {
+	for key, value := range query {
 		q.Add(key, fmt.Sprintf("%v", value))
 	}
 	req.URL.RawQuery = q.Encode()
 
-	for k, v := range h.Input.Header.Value {
+	for k, v := range header {
 		for _, vv := range v {
 			req.Header.Add(k, vv)
 		}
 	}
 	for k, v := range h.getEncodingHeader() {
+		if req.Header.Get(k) != "" {
+			// Explicitly specified headers take precedence.
+			continue
+		}
 		for _, vv := range v {
 			req.Header.Add(k, vv)
 		}
 	}
 
+	if err := auth.apply(ctx, h.client, req); err != nil {
+		return nil, HTTPAuth{}, fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	return req, auth, nil
+}
+
+// do sends the request and makes the output from the response.
+func (h *HTTP) do(ctx context.Context, req *http.Request, auth HTTPAuth) (orchestrator.Output, error) {
+	// Propagate the trace context, if any, unless the headers have been
+	// specified explicitly.
+	if tc, ok := orchestrator.TraceContextFromContext(ctx); ok && req.Header.Get(orchestrator.HeaderTraceParent) == "" {
+		// Each outbound request is a child span of the incoming trace context.
+		span := tc.NewSpan()
+		req.Header.Set(orchestrator.HeaderTraceParent, span.TraceParent())
+		if span.State != "" {
+			req.Header.Set(orchestrator.HeaderTraceState, span.State)
+		}
+	}
+
+	start := time.Now()
 	resp, err := h.client.Do(req)
 	if err != nil {
+		orchestrator.Log(ctx, err, "http request", "method", req.Method, "url", req.URL.String(), "latency", time.Since(start))
 		return nil, err
 	}
+	orchestrator.Log(ctx, nil, "http request", "method", req.Method, "url", req.URL.String(), "status", resp.StatusCode, "latency", time.Since(start))
 
-	respContentType := resp.Header.Get("Content-Type")
-	mediatype, _, err := mime.ParseMediaType(respContentType)
-	if err != nil {
-		resp.Body.Close()
-		return nil, err
+	if resp.StatusCode == http.StatusUnauthorized {
+		// The cached credentials (if any) may have been revoked.
+		auth.invalidate()
+	}
+
+	var mediatype string
+	if respContentType := resp.Header.Get("Content-Type"); respContentType != "" {
+		mediatype, _, err = mime.ParseMediaType(respContentType)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+
+	if !h.expectStatus.Match(resp.StatusCode) {
+		// Truncate an oversized body instead of failing.
+		_ = h.limitBody(resp)
+		return nil, newHTTPError(resp, mediatype)
 	}
 
 	var respBody any
 
 	switch mediatype {
 	case "text/event-stream": // Sever-Sent Events
-		respBody = orchestrator.NewIterator(ctx, func(sender *orchestrator.IteratorSender) {
-			defer sender.End() // End the iteration
-
-			defer resp.Body.Close()
-			reader := NewEventStreamReader(resp.Body, 1<<16)
-
-			for {
-				event, err := reader.ReadEvent()
-				if err != nil {
-					if err == io.EOF {
-						// Reach the end of the response payload.
-						return
-					}
-
-					sender.Send(nil, err)
-					return
-				}
-
-				// Send the event if it has something useful.
-				if len(event.Data) > 0 {
-					data := string(event.Data)
-					if h.Input.SSEFilter != "" {
-						evaluator := orchestrator.NewEvaluatorWithData(map[string]any{"data": data})
-						value, err := evaluator.Evaluate(h.Input.SSEFilter)
-						if err != nil {
-							sender.Send(nil, fmt.Errorf("failed to evaluate '%s': %v", h.Input.SSEFilter, err))
-							return
-						}
-						// We assume that the event data is always a string.
-						data = fmt.Sprintf("%v", value)
-					}
-					// For simplicity, currently we only handle data-only sever-sent events.
-					if continue_ := sender.Send(orchestrator.Output{"data": data}, nil); !continue_ {
-						return
-					}
-				}
-			}
-		})
+		respBody = h.streamEvents(ctx, req, resp)
 
 	case "application/x-ndjson": // Newline-delimited JSON
 		respBody = orchestrator.NewIterator(ctx, func(sender *orchestrator.IteratorSender) {
@@ -236,19 +311,19 @@ func (h *HTTP) Execute(ctx context.Context, input orchestrator.Input) (orchestra
 				dataBytes := reader.Bytes()
 				data := string(dataBytes)
 				if len(data) > 0 {
-					if h.Input.SSEFilter != "" {
-						evaluator := orchestrator.NewEvaluatorWithData(map[string]any{"data": data})
-						value, err := evaluator.Evaluate(h.Input.SSEFilter)
-						if err != nil {
-							sender.Send(nil, fmt.Errorf("failed to evaluate '%s': %v", h.Input.SSEFilter, err))
-							return
-						}
-						// We assume that the event data is always a string.
-						data = fmt.Sprintf("%v", value)
+					// For compatibility, we mimic a server-sent event with only data.
+					output, done, err := h.streamOutput(orchestrator.Output{}, data)
+					if err != nil {
+						sender.Send(nil, err)
+						return
 					}
-
-					// For compatibility, currently we send the data as a string (i.e. mimic a server-sent event).
-					if continue_ := sender.Send(orchestrator.Output{"data": data}, nil); !continue_ {
+					if done {
+						return
+					}
+					if output == nil {
+						continue
+					}
+					if continue_ := sender.Send(output, nil); !continue_ {
 						return
 					}
 				}
@@ -260,21 +335,27 @@ func (h *HTTP) Execute(ctx context.Context, input orchestrator.Input) (orchestra
 			}
 		})
 
-	case "application/json": // JSON
-		defer resp.Body.Close()
-		var m any
-		if err := h.codec.Decode(resp.Body, &m); err != nil {
+	default:
+		if err := h.limitBody(resp); err != nil {
+			resp.Body.Close()
 			return nil, err
 		}
-		respBody = m
 
-	default: // Other content
-		defer resp.Body.Close()
-		b, err := io.ReadAll(resp.Body)
-		if err != nil && err != io.EOF {
-			return nil, err
+		switch h.Input.ResponseMode {
+		case ResponseModeReader:
+			// The body will be closed by the consumer.
+			respBody = responseReader{ReadCloser: resp.Body}
+		case ResponseModeFile:
+			defer resp.Body.Close()
+			if respBody, err = saveBody(resp.Body); err != nil {
+				return nil, err
+			}
+		default:
+			defer resp.Body.Close()
+			if respBody, err = decodeBody(resp.Body, mediatype); err != nil {
+				return nil, err
+			}
 		}
-		respBody = string(b)
 	}
 
 	return orchestrator.Output{
@@ -284,6 +365,40 @@ func (h *HTTP) Execute(ctx context.Context, input orchestrator.Input) (orchestra
 	}, nil
 }
 
+// limitBody limits the size of the response body if required. It fails fast
+// if the body is known to be too large.
+func (h *HTTP) limitBody(resp *http.Response) error {
+	max := h.Input.MaxResponseBytes
+	if max <= 0 {
+		return nil
+	}
+	resp.Body = newLimitedBody(resp.Body, max)
+	if resp.ContentLength > max {
+		return responseTooLarge(max)
+	}
+	return nil
+}
+
+// decodeBody decodes the body according to the media type. The body is kept
+// as a string if the content is not structured.
+func decodeBody(body io.Reader, mediatype string) (any, error) {
+	// Structured content (e.g. JSON and XML)
+	if codec, ok := codecForMediaType(mediatype); ok {
+		var m any
+		if err := codec.Decode(body, &m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	// Other content
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
 type HTTPBuilder struct {
 	task *HTTP
 }
@@ -294,7 +409,6 @@ func NewHTTP(name string) *HTTPBuilder {
 			Name: name,
 			Type: TypeHTTP,
 		},
-		client: &http.Client{},
 	}
 	task = task.Encoding("json")
 	return &HTTPBuilder{task: task}
@@ -302,7 +416,6 @@ func NewHTTP(name string) *HTTPBuilder {
 
 func (b *HTTPBuilder) Timeout(timeout time.Duration) *HTTPBuilder {
 	b.task.Timeout = timeout
-	b.task.client.Timeout = timeout
 	return b
 }
 
@@ -348,11 +461,124 @@ func (b *HTTPBuilder) Header(key string, values ...string) *HTTPBuilder {
 	return b
 }
 
-func (b *HTTPBuilder) Body(body map[string]any) *HTTPBuilder {
-	b.task.Input.Body = orchestrator.Expr[map[string]any]{Expr: body}
+// Encoding sets the encoding of the request body, which is one of "json"
+// (the default), "form", "multipart", "text" and "xml".
+func (b *HTTPBuilder) Encoding(encoding string) *HTTPBuilder {
+	b.task.Encoding(encoding)
+	return b
+}
+
+// Body sets the request body, which can be any value (e.g. a map, a slice,
+// a scalar or an expression) and will be encoded according to the encoding.
+func (b *HTTPBuilder) Body(body any) *HTTPBuilder {
+	b.task.Input.Body = orchestrator.Expr[any]{Expr: body}
+	b.task.Input.RawBody = false
+	return b
+}
+
+// RawBody sets the request body, which must be (or be evaluated to) a string,
+// a byte slice or an io.Reader, and will be sent as is. Note that the Content-Type header
+// still follows the encoding, which can be overridden by Header.
+func (b *HTTPBuilder) RawBody(body any) *HTTPBuilder {
+	b.task.Input.Body = orchestrator.Expr[any]{Expr: body}
+	b.task.Input.RawBody = true
+	return b
+}
+
+// SSE sets the options for consuming server-sent events.
+func (b *HTTPBuilder) SSE(opts SSEOptions) *HTTPBuilder {
+	b.task.Input.SSE = opts
+	return b
+}
+
+// Stream sets the options for handling the events of a streamed response.
+func (b *HTTPBuilder) Stream(opts StreamOptions) *HTTPBuilder {
+	if err := opts.validate(); err != nil {
+		panic(err)
+	}
+	b.task.Input.Stream = opts
+	return b
+}
+
+// ExpectStatus sets the expected statuses (see HTTP.Input.ExpectStatus).
+func (b *HTTPBuilder) ExpectStatus(statuses ...any) *HTTPBuilder {
+	m, err := parseStatusMatcher(statuses)
+	if err != nil {
+		panic(err)
+	}
+	b.task.Input.ExpectStatus = statuses
+	b.task.expectStatus = m
+	return b
+}
+
+func (b *HTTPBuilder) BasicAuth(username, password string) *HTTPBuilder {
+	b.task.Input.Auth = orchestrator.Expr[HTTPAuth]{Expr: map[string]any{
+		"type":     string(HTTPAuthBasic),
+		"username": username,
+		"password": password,
+	}}
+	return b
+}
+
+// BearerAuth sets the bearer token, which may be an expression
+// (e.g. "${secret('API_TOKEN')}").
+func (b *HTTPBuilder) BearerAuth(token string) *HTTPBuilder {
+	b.task.Input.Auth = orchestrator.Expr[HTTPAuth]{Expr: map[string]any{
+		"type":  string(HTTPAuthBearer),
+		"token": token,
+	}}
+	return b
+}
+
+// OAuth2ClientCredentials authenticates requests by using tokens obtained
+// from the token endpoint through the OAuth2 client credentials grant.
+func (b *HTTPBuilder) OAuth2ClientCredentials(tokenURL, clientID, clientSecret string, scopes ...string) *HTTPBuilder {
+	b.task.Input.Auth = orchestrator.Expr[HTTPAuth]{Expr: map[string]any{
+		"type":          string(HTTPAuthOAuth2ClientCredentials),
+		"token_url":     tokenURL,
+		"client_id":     clientID,
+		"client_secret": clientSecret,
+		"scopes":        scopes,
+	}}
+	return b
+}
+
+// Client sets the name of the connection profile, which is registered in
+// orchestrator.GlobalRegistry.
+func (b *HTTPBuilder) Client(name string) *HTTPBuilder {
+	b.task.Input.Client = name
+	return b
+}
+
+func (b *HTTPBuilder) InsecureSkipVerify() *HTTPBuilder {
+	b.task.Input.InsecureSkipVerify = true
+	return b
+}
+
+// MaxRedirects sets the maximum number of redirects to follow. Zero means not
+// to follow redirects.
+func (b *HTTPBuilder) MaxRedirects(n int) *HTTPBuilder {
+	b.task.Input.MaxRedirects = &n
+	return b
+}
+
+// MaxResponseBytes sets the maximum size of a non-streamed response body.
+func (b *HTTPBuilder) MaxResponseBytes(n int64) *HTTPBuilder {
+	b.task.Input.MaxResponseBytes = n
+	return b
+}
+
+// ResponseMode sets how a non-streamed response body is made into the output.
+func (b *HTTPBuilder) ResponseMode(mode ResponseMode) *HTTPBuilder {
+	b.task.Input.ResponseMode = mode
 	return b
 }
 
 func (b *HTTPBuilder) Build() orchestrator.Task {
+	client, err := newHTTPClient(orchestrator.GlobalRegistry, b.task.Input.HTTPClientOptions, b.task.Timeout)
+	if err != nil {
+		panic(err)
+	}
+	b.task.client = client
 	return b.task
 }
@@ -0,0 +1,255 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+// defaultSSERetry is the default reconnection delay, which can be changed by
+// the server through the "retry" field.
+const defaultSSERetry = 3 * time.Second
+
+var (
+	errSSEIdleTimeout = errors.New("no events received")
+	errSSEStopped     = errors.New("iteration stopped")
+)
+
+// SSEOptions are the options for consuming server-sent events.
+type SSEOptions struct {
+	// Events are the event types to emit. Empty means all types. Note that
+	// the type of an event defaults to "message".
+	Events []string `json:"events"`
+	// MaxReconnects is the maximum number of consecutive reconnections when
+	// the connection is closed or dropped. Zero means no reconnection.
+	MaxReconnects int `json:"max_reconnects"`
+	// Retry is the initial reconnection delay, which defaults to 3s.
+	Retry time.Duration `json:"retry"`
+	// IdleTimeout fails the stream if no events (including comments, which
+	// are typically sent as heartbeats) arrive within the duration. Zero means
+	// no timeout.
+	IdleTimeout time.Duration `json:"idle_timeout"`
+}
+
+// sseStream consumes server-sent events from one or more connections.
+type sseStream struct {
+	h      *HTTP
+	req    *http.Request
+	opts   SSEOptions
+	sender *orchestrator.IteratorSender
+
+	lastEventID string
+	retry       time.Duration
+}
+
+// streamEvents returns an iterator that emits each server-sent event as an
+// output of the form {"event": ..., "id": ..., "data": ...}, where "id" is the
+// last event ID.
+func (h *HTTP) streamEvents(ctx context.Context, req *http.Request, resp *http.Response) *orchestrator.Iterator {
+	return orchestrator.NewIterator(ctx, func(sender *orchestrator.IteratorSender) {
+		defer sender.End() // End the iteration
+
+		s := &sseStream{
+			h:      h,
+			req:    req,
+			opts:   h.Input.SSE,
+			sender: sender,
+			retry:  h.Input.SSE.Retry,
+		}
+		if s.retry <= 0 {
+			s.retry = defaultSSERetry
+		}
+		s.run(ctx, resp)
+	})
+}
+
+func (s *sseStream) run(ctx context.Context, resp *http.Response) {
+	attempts := 0
+	for {
+		received, err := s.consume(ctx, resp)
+		switch {
+		case errors.Is(err, errSSEStopped):
+			return
+		case errors.Is(err, errSSEIdleTimeout):
+			s.sender.Send(nil, err)
+			return
+		}
+		if received {
+			attempts = 0
+		}
+
+		// The connection has been closed or dropped, try to reconnect.
+		for {
+			if attempts >= s.opts.MaxReconnects {
+				if err != nil {
+					s.sender.Send(nil, err)
+				}
+				return
+			}
+			attempts++
+
+			timer := time.NewTimer(s.retry)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+
+			var retryable bool
+			resp, retryable, err = s.reconnect(ctx)
+			if err == nil || !retryable {
+				break
+			}
+		}
+		if err != nil {
+			s.sender.Send(nil, err)
+			return
+		}
+		if resp == nil {
+			// The server asked us to stop reconnecting.
+			return
+		}
+	}
+}
+
+// consume reads and emits events from the response until the connection
+// is closed (in which case the error is nil) or dropped.
+func (s *sseStream) consume(ctx context.Context, resp *http.Response) (received bool, err error) {
+	defer resp.Body.Close()
+
+	var idled atomic.Bool
+	reset := func() {}
+	if d := s.opts.IdleTimeout; d > 0 {
+		timer := time.AfterFunc(d, func() {
+			idled.Store(true)
+			// Interrupt the blocking read.
+			resp.Body.Close()
+		})
+		defer timer.Stop()
+		reset = func() { timer.Reset(d) }
+	}
+
+	reader := NewEventStreamReader(resp.Body, 1<<16)
+	for {
+		event, err := reader.ReadEvent()
+		if idled.Load() {
+			return received, fmt.Errorf("%w within %s", errSSEIdleTimeout, s.opts.IdleTimeout)
+		}
+		if ctx.Err() != nil {
+			return received, errSSEStopped
+		}
+		if err != nil {
+			if err == io.EOF {
+				// Reach the end of the response payload.
+				return received, nil
+			}
+			return received, err
+		}
+		reset()
+
+		if len(event.ID) > 0 {
+			s.lastEventID = string(event.ID)
+		}
+		if len(event.Retry) > 0 {
+			if ms, err := strconv.Atoi(string(event.Retry)); err == nil && ms >= 0 {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+
+		// Only dispatch the event if it has data, per the spec.
+		if len(event.Data) == 0 {
+			continue
+		}
+		received = true
+
+		typ := string(event.Event)
+		if typ == "" {
+			typ = "message"
+		}
+		if !s.wanted(typ) {
+			continue
+		}
+
+		output, done, err := s.h.streamOutput(orchestrator.Output{
+			"event": typ,
+			"id":    s.lastEventID,
+		}, string(event.Data))
+		if err != nil {
+			s.sender.Send(nil, err)
+			return received, errSSEStopped
+		}
+		if done {
+			// The stream has been ended by the sentinel.
+			return received, errSSEStopped
+		}
+		if output == nil {
+			continue
+		}
+
+		if continue_ := s.sender.Send(output, nil); !continue_ {
+			return received, errSSEStopped
+		}
+	}
+}
+
+func (s *sseStream) wanted(typ string) bool {
+	if len(s.opts.Events) == 0 {
+		return true
+	}
+	for _, t := range s.opts.Events {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// reconnect re-sends the original request with the last event ID. It returns
+// a nil response if the server responds with 204 No Content, which means to
+// stop reconnecting. It fails if the request body can not be replayed.
+func (s *sseStream) reconnect(ctx context.Context) (resp *http.Response, retryable bool, err error) {
+	req := s.req.Clone(ctx)
+	switch {
+	case s.req.GetBody != nil:
+		if req.Body, err = s.req.GetBody(); err != nil {
+			return nil, false, err
+		}
+	case s.req.Body != nil && s.req.Body != http.NoBody:
+		// The body (e.g. a raw reader) has been consumed by the previous
+		// request, and thus can not be re-sent.
+		return nil, false, fmt.Errorf("can not reconnect since the request body can not be re-sent")
+	}
+	if s.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", s.lastEventID)
+	}
+
+	start := time.Now()
+	resp, err = s.h.client.Do(req)
+	if err != nil {
+		orchestrator.Log(ctx, err, "sse reconnect", "method", req.Method, "url", req.URL.String(), "latency", time.Since(start))
+		return nil, ctx.Err() == nil, err
+	}
+	orchestrator.Log(ctx, nil, "sse reconnect", "method", req.Method, "url", req.URL.String(), "status", resp.StatusCode, "latency", time.Since(start))
+
+	mediatype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		resp.Body.Close()
+		return nil, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, newHTTPError(resp, mediatype)
+	case mediatype != "text/event-stream":
+		resp.Body.Close()
+		return nil, false, fmt.Errorf("bad content type %q of server-sent events", mediatype)
+	}
+	return resp, false, nil
+}
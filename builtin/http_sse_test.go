@@ -0,0 +1,330 @@
+package builtin_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	o "github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+	"github.com/google/go-cmp/cmp"
+)
+
+// collectEvents executes the task and collects all the outputs (or the
+// error) from the resulting iterator.
+func collectEvents(t *testing.T, task o.Task) (outputs []o.Output, err error) {
+	output, err := task.Execute(context.Background(), o.NewInput(nil))
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	iterator, ok := output["body"].(*o.Iterator)
+	if !ok {
+		t.Fatalf("Body: Got (%T) != Want (*Iterator)", output["body"])
+	}
+	for result := range iterator.Next() {
+		if result.Err != nil {
+			err = result.Err
+			continue
+		}
+		outputs = append(outputs, result.Output)
+	}
+	return outputs, err
+}
+
+func TestHTTP_SSE(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(strings.Join([]string{
+			": heartbeat\n",
+			"data: hello\n",
+			"id: 1\nevent: update\ndata: {\"n\": 1}\n",
+			"event: ping\ndata: pong\n",
+			"event: update\ndata: line1\ndata: line2\n",
+		}, "\n")))
+	}))
+	defer server.Close()
+
+	t.Run("all events", func(t *testing.T) {
+		got, err := collectEvents(t, builtin.NewHTTP("test").Get(server.URL).Build())
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		want := []o.Output{
+			{"event": "message", "id": "", "data": "hello"},
+			{"event": "update", "id": "1", "data": `{"n": 1}`},
+			{"event": "ping", "id": "1", "data": "pong"},
+			{"event": "update", "id": "1", "data": "line1\nline2"},
+		}
+		if !cmp.Equal(got, want) {
+			t.Fatalf("Diff: %v", cmp.Diff(got, want))
+		}
+	})
+
+	t.Run("filtered events", func(t *testing.T) {
+		task := builtin.NewHTTP("test").Get(server.URL).SSE(builtin.SSEOptions{
+			Events: []string{"update"},
+		}).Build()
+		got, err := collectEvents(t, task)
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		want := []o.Output{
+			{"event": "update", "id": "1", "data": `{"n": 1}`},
+			{"event": "update", "id": "1", "data": "line1\nline2"},
+		}
+		if !cmp.Equal(got, want) {
+			t.Fatalf("Diff: %v", cmp.Diff(got, want))
+		}
+	})
+}
+
+func TestHTTP_SSE_Reconnect(t *testing.T) {
+	var connections atomic.Int32
+	var gotLastEventIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := connections.Add(1)
+		gotLastEventIDs = append(gotLastEventIDs, r.Header.Get("Last-Event-ID"))
+		switch n {
+		case 1:
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("retry: 10\nid: 1\ndata: a\n\n"))
+		case 2:
+			// Drop the connection without any events.
+			w.Header().Set("Content-Type", "text/event-stream")
+		case 3:
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("id: 2\ndata: b\n\n"))
+		default:
+			// Stop reconnecting.
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	task, err := o.ConstructFromYAML([]byte(fmt.Sprintf(`
+name: test
+type: http
+input:
+  method: GET
+  uri: %s
+  sse:
+    max_reconnects: 2
+    retry: 1h
+`, server.URL)))
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	got, err := collectEvents(t, task)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	want := []o.Output{
+		{"event": "message", "id": "1", "data": "a"},
+		{"event": "message", "id": "2", "data": "b"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Fatalf("Diff: %v", cmp.Diff(got, want))
+	}
+
+	wantLastEventIDs := []string{"", "1", "1", "2"}
+	if !cmp.Equal(gotLastEventIDs, wantLastEventIDs) {
+		t.Fatalf("Last-Event-ID: Got (%v) != Want (%v)", gotLastEventIDs, wantLastEventIDs)
+	}
+}
+
+func TestHTTP_SSE_Reconnect_Body(t *testing.T) {
+	var gotBodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBodies = append(gotBodies, string(body))
+		if len(gotBodies) > 1 {
+			// Stop reconnecting.
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: a\n\n"))
+	}))
+	defer server.Close()
+
+	newTask := func() o.Task {
+		return builtin.NewHTTP("test").Post(server.URL).RawBody("${input.body}").SSE(builtin.SSEOptions{
+			MaxReconnects: 1,
+			Retry:         time.Millisecond,
+		}).Build()
+	}
+	execute := func(body any) ([]o.Output, error) {
+		output, err := newTask().Execute(context.Background(), o.NewInput(map[string]any{"body": body}))
+		if err != nil {
+			return nil, err
+		}
+		iterator := output["body"].(*o.Iterator)
+		var events []o.Output
+		for result := range iterator.Next() {
+			if result.Err != nil {
+				return events, result.Err
+			}
+			events = append(events, result.Output)
+		}
+		return events, nil
+	}
+
+	// A replayable body is re-sent on reconnection.
+	got, err := execute("query")
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(got) != 1 || !cmp.Equal(gotBodies, []string{"query", "query"}) {
+		t.Fatalf("Events: Got (%v), Bodies: Got (%q)", got, gotBodies)
+	}
+
+	// A reader can only be sent once.
+	gotBodies = nil
+	got, err = execute(io.MultiReader(strings.NewReader("query")))
+	wantErr := "can not reconnect since the request body can not be re-sent"
+	if err == nil || err.Error() != wantErr {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, wantErr)
+	}
+	if len(got) != 1 || !cmp.Equal(gotBodies, []string{"query"}) {
+		t.Fatalf("Events: Got (%v), Bodies: Got (%q)", got, gotBodies)
+	}
+}
+
+func TestHTTP_SSE_IdleTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: a\n\n"))
+		w.(http.Flusher).Flush()
+		// Hang until the client goes away.
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	task := builtin.NewHTTP("test").Get(server.URL).SSE(builtin.SSEOptions{
+		MaxReconnects: 1,
+		IdleTimeout:   50 * time.Millisecond,
+	}).Build()
+
+	got, err := collectEvents(t, task)
+	want := []o.Output{{"event": "message", "id": "", "data": "a"}}
+	if !cmp.Equal(got, want) {
+		t.Fatalf("Diff: %v", cmp.Diff(got, want))
+	}
+	wantErr := "no events received within 50ms"
+	if err == nil || err.Error() != wantErr {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, wantErr)
+	}
+}
+
+func TestHTTP_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sse":
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte(strings.Join([]string{
+				`data: {"delta": {"content": "Hi"}, "n": 1}` + "\n",
+				`data: {"delta": {"content": "!"}, "n": 2}` + "\n",
+				"data: [DONE]\n",
+				`data: {"delta": {"content": "ignored"}}` + "\n",
+			}, "\n")))
+		case "/ndjson":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			_, _ = w.Write([]byte(strings.Join([]string{
+				`{"content": "Hi"}`,
+				``,
+				`{"content": "!"}`,
+				`[DONE]`,
+				`{"content": "ignored"}`,
+			}, "\n")))
+		}
+	}))
+	defer server.Close()
+
+	construct := func(path, stream string) o.Task {
+		task, err := o.ConstructFromYAML([]byte(fmt.Sprintf(`
+name: test
+type: http
+input:
+  method: GET
+  uri: %s%s
+%s
+`, server.URL, path, stream)))
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		return task
+	}
+
+	tests := []struct {
+		name   string
+		inTask o.Task
+		want   []o.Output
+	}{
+		{
+			name: "sse text",
+			inTask: construct("/sse", `
+  stream:
+    done: "[DONE]"
+  sse_filter: ${jsondecode(data)["n"]}`),
+			want: []o.Output{
+				{"event": "message", "id": "", "data": "1"},
+				{"event": "message", "id": "", "data": "2"},
+			},
+		},
+		{
+			name: "sse json",
+			inTask: construct("/sse", `
+  stream:
+    decode: json
+    done: "[DONE]"
+  sse_filter: ${data["delta"]}`),
+			want: []o.Output{
+				{"event": "message", "id": "", "data": map[string]any{"content": "Hi"}},
+				{"event": "message", "id": "", "data": map[string]any{"content": "!"}},
+			},
+		},
+		{
+			name: "ndjson json",
+			inTask: construct("/ndjson", `
+  stream:
+    decode: json
+    done: "[DONE]"`),
+			want: []o.Output{
+				{"data": map[string]any{"content": "Hi"}},
+				{"data": map[string]any{"content": "!"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := collectEvents(t, tt.inTask)
+			if err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Fatalf("Diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+
+	_, err := o.ConstructFromYAML([]byte(`
+name: test
+type: http
+input:
+  method: GET
+  uri: http://example.com
+  stream:
+    decode: xml
+`))
+	if err == nil || err.Error() != `bad stream decode "xml"` {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, `bad stream decode "xml"`)
+	}
+}
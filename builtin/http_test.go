@@ -2,7 +2,16 @@ package builtin_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	o "github.com/RussellLuo/orchestrator"
@@ -79,3 +88,855 @@ func TestHTTP_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTP_TraceContext(t *testing.T) {
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	incoming, err := o.ParseTraceContext("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "congo=t61rcWkgMzE")
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	ctx := o.ContextWithTraceContext(context.Background(), incoming)
+
+	task := builtin.NewHTTP("test").Get(server.URL).Build()
+	if _, err := task.Execute(ctx, o.NewInput(nil)); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	got, err := o.TraceContextFromHeader(gotHeader)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if got.TraceID != incoming.TraceID {
+		t.Fatalf("TraceID: Got (%x) != Want (%x)", got.TraceID, incoming.TraceID)
+	}
+	if got.SpanID == incoming.SpanID {
+		t.Fatalf("SpanID: Got (%x) == Parent (%x)", got.SpanID, incoming.SpanID)
+	}
+	if got.State != incoming.State {
+		t.Fatalf("State: Got (%q) != Want (%q)", got.State, incoming.State)
+	}
+}
+
+func TestHTTP_Encoding(t *testing.T) {
+	type request struct {
+		contentType string
+		body        string
+	}
+	var got request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = request{contentType: r.Header.Get("Content-Type"), body: string(body)}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     map[string]any
+		want     request
+	}{
+		{
+			name:     "json",
+			encoding: "json",
+			body:     map[string]any{"name": "bob"},
+			want: request{
+				contentType: "application/json",
+				body:        `{"name":"bob"}`,
+			},
+		},
+		{
+			name:     "form",
+			encoding: "form",
+			body:     map[string]any{"name": "bob", "tags": []any{"a", "b"}},
+			want: request{
+				contentType: "application/x-www-form-urlencoded",
+				body:        "name=bob&tags=a&tags=b",
+			},
+		},
+		{
+			name:     "text",
+			encoding: "text",
+			body:     map[string]any{"name": "bob"},
+			want: request{
+				contentType: "text/plain; charset=utf-8",
+				body:        "map[name:bob]",
+			},
+		},
+		{
+			name:     "xml",
+			encoding: "xml",
+			body: map[string]any{"user": map[string]any{
+				"@id":  1,
+				"name": "bob",
+				"tags": map[string]any{"tag": []any{"a", "b"}},
+			}},
+			want: request{
+				contentType: "application/xml",
+				body:        `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<user id="1"><name>bob</name><tags><tag>a</tag><tag>b</tag></tags></user>`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := builtin.NewHTTP("test").Encoding(tt.encoding).Post(server.URL).Body(tt.body).Build()
+			if _, err := task.Execute(context.Background(), o.NewInput(nil)); err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Request: Got (%#v) != Want (%#v)", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTP_Encoding_Multipart(t *testing.T) {
+	type part struct {
+		filename, contentType, content string
+	}
+	got := make(map[string]part)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			p, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			content, _ := io.ReadAll(p)
+			got[p.FormName()] = part{p.FileName(), p.Header.Get("Content-Type"), string(content)}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	task := builtin.NewHTTP("test").Encoding("multipart").Post(server.URL).Body(map[string]any{
+		"name": "bob",
+		"avatar": map[string]any{
+			"filename":     "avatar.png",
+			"content":      "PNG",
+			"content_type": "image/png",
+		},
+	}).Build()
+	output, err := task.Execute(context.Background(), o.NewInput(nil))
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if output["status"] != http.StatusNoContent {
+		t.Fatalf("Status: Got (%v) != Want (%v)", output["status"], http.StatusNoContent)
+	}
+
+	want := map[string]part{
+		"name":   {"", "", "bob"},
+		"avatar": {"avatar.png", "image/png", "PNG"},
+	}
+	if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", want) {
+		t.Fatalf("Parts: Got (%v) != Want (%v)", got, want)
+	}
+}
+
+func TestHTTP_Encoding_Multipart_Path(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, _ := header.Open()
+		defer f.Close()
+		_, _ = io.Copy(w, f)
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	baseDir := filepath.Join(root, "base")
+	if err := os.Mkdir(baseDir, 0o755); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(baseDir, "upload.txt"), []byte("upload"), 0o644); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	secret := filepath.Join(root, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0o644); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if err := os.Symlink(secret, filepath.Join(baseDir, "link.txt")); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	defer func(dir string) { builtin.MultipartBaseDir = dir }(builtin.MultipartBaseDir)
+
+	tests := []struct {
+		name     string
+		inDir    string
+		inPath   string
+		wantBody string
+		wantErr  string
+	}{
+		{
+			name:     "relative",
+			inDir:    baseDir,
+			inPath:   "upload.txt",
+			wantBody: "upload",
+		},
+		{
+			name:     "absolute",
+			inDir:    baseDir,
+			inPath:   filepath.Join(baseDir, "upload.txt"),
+			wantBody: "upload",
+		},
+		{
+			name:    "no base dir",
+			inPath:  filepath.Join(baseDir, "upload.txt"),
+			wantErr: "no multipart base directory configured",
+		},
+		{
+			name:    "traversal",
+			inDir:   baseDir,
+			inPath:  "../secret.txt",
+			wantErr: "outside of the multipart base directory",
+		},
+		{
+			name:    "absolute outside",
+			inDir:   baseDir,
+			inPath:  secret,
+			wantErr: "outside of the multipart base directory",
+		},
+		{
+			name:    "symlink outside",
+			inDir:   baseDir,
+			inPath:  "link.txt",
+			wantErr: "outside of the multipart base directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builtin.MultipartBaseDir = tt.inDir
+			task := builtin.NewHTTP("test").Encoding("multipart").Post(server.URL).Body(map[string]any{
+				"file": map[string]any{
+					"filename": "file.txt",
+					"path":     tt.inPath,
+				},
+			}).Build()
+
+			output, err := task.Execute(context.Background(), o.NewInput(nil))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Err: Got (%v) != Want (%q)", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if output["body"] != tt.wantBody {
+				t.Fatalf("Body: Got (%v) != Want (%v)", output["body"], tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHTTP_DecodeResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        any
+	}{
+		{
+			name:        "json",
+			contentType: "application/problem+json",
+			body:        `{"title":"oops"}`,
+			want:        map[string]any{"title": "oops"},
+		},
+		{
+			name:        "xml",
+			contentType: "application/xml; charset=utf-8",
+			body:        `<users><user id="1"><name>bob</name></user><user id="2">alice</user></users>`,
+			want: map[string]any{"users": map[string]any{"user": []any{
+				map[string]any{"@id": "1", "name": "bob"},
+				map[string]any{"@id": "2", "#text": "alice"},
+			}}},
+		},
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=bob&tags=a&tags=b",
+			want:        map[string]any{"name": "bob", "tags": []any{"a", "b"}},
+		},
+		{
+			name:        "text",
+			contentType: "text/plain",
+			body:        "hello",
+			want:        "hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				_, _ = io.Copy(w, strings.NewReader(tt.body))
+			}))
+			defer server.Close()
+
+			task := builtin.NewHTTP("test").Get(server.URL).Build()
+			output, err := task.Execute(context.Background(), o.NewInput(nil))
+			if err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if fmt.Sprintf("%v", output["body"]) != fmt.Sprintf("%v", tt.want) {
+				t.Fatalf("Body: Got (%v) != Want (%v)", output["body"], tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTP_Body(t *testing.T) {
+	type request struct {
+		contentType string
+		body        string
+	}
+	var got request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = request{contentType: r.Header.Get("Content-Type"), body: string(body)}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		inInput map[string]any
+		inTask  o.Task
+		want    request
+		wantErr string
+	}{
+		{
+			name:   "array",
+			inTask: builtin.NewHTTP("test").Post(server.URL).Body([]any{1, "a"}).Build(),
+			want:   request{contentType: "application/json", body: `[1,"a"]`},
+		},
+		{
+			name:   "scalar",
+			inTask: builtin.NewHTTP("test").Post(server.URL).Body("hello").Build(),
+			want:   request{contentType: "application/json", body: `"hello"`},
+		},
+		{
+			name:    "expression",
+			inInput: map[string]any{"ids": []any{1, 2}},
+			inTask:  builtin.NewHTTP("test").Post(server.URL).Body("${input.ids}").Build(),
+			want:    request{contentType: "application/json", body: `[1,2]`},
+		},
+		{
+			name:    "raw string",
+			inInput: map[string]any{"payload": `{"name":"bob"}`},
+			inTask:  builtin.NewHTTP("test").Post(server.URL).RawBody("${input.payload}").Build(),
+			want:    request{contentType: "application/json", body: `{"name":"bob"}`},
+		},
+		{
+			name: "raw bytes with content type",
+			inTask: builtin.NewHTTP("test").Post(server.URL).
+				Header("Content-Type", "application/octet-stream").
+				RawBody([]byte("\x00\x01")).Build(),
+			want: request{contentType: "application/octet-stream", body: "\x00\x01"},
+		},
+		{
+			name:    "bad raw body",
+			inTask:  builtin.NewHTTP("test").Post(server.URL).RawBody(map[string]any{"a": 1}).Build(),
+			wantErr: "raw body must be a string, bytes or a reader, but got map[string]interface {}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = request{}
+			_, err := tt.inTask.Execute(context.Background(), o.NewInput(tt.inInput))
+
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Fatalf("Err: Got (%q) != Want (%q)", gotErr, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Request: Got (%#v) != Want (%#v)", got, tt.want)
+			}
+		})
+	}
+
+	// The same task is executed repeatedly with bodies of different shapes.
+	task := builtin.NewHTTP("test").Post(server.URL).Body("${input.payload}").Build()
+	for _, tt := range []struct {
+		inPayload any
+		wantBody  string
+	}{
+		{inPayload: []any{1, 2}, wantBody: `[1,2]`},
+		{inPayload: map[string]any{"a": 1}, wantBody: `{"a":1}`},
+		{inPayload: nil, wantBody: ``},
+	} {
+		got = request{}
+		if _, err := task.Execute(context.Background(), o.NewInput(map[string]any{"payload": tt.inPayload})); err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		if got.body != tt.wantBody {
+			t.Fatalf("Body: Got (%q) != Want (%q)", got.body, tt.wantBody)
+		}
+	}
+}
+
+func TestHTTP_ExpectStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("status") {
+		case "404":
+			w.WriteHeader(http.StatusNotFound)
+		case "500":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":"oops"}`))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	newTask := func(expectStatus ...any) o.Task {
+		task, err := o.Construct(map[string]any{
+			"name": "test",
+			"type": "http",
+			"input": map[string]any{
+				"method":        "GET",
+				"uri":           server.URL + "?status=${input.status}",
+				"expect_status": expectStatus,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		return task
+	}
+
+	tests := []struct {
+		name       string
+		inStatus   int
+		inTask     o.Task
+		wantStatus int
+		wantErr    *builtin.HTTPError
+	}{
+		{
+			name:       "no expectation",
+			inStatus:   500,
+			inTask:     builtin.NewHTTP("test").Get(server.URL + "?status=${input.status}").Build(),
+			wantStatus: 500,
+		},
+		{
+			name:       "class",
+			inStatus:   200,
+			inTask:     newTask("2xx"),
+			wantStatus: 200,
+		},
+		{
+			name:       "status code",
+			inStatus:   404,
+			inTask:     newTask("2xx", 404),
+			wantStatus: 404,
+		},
+		{
+			name:     "unexpected status",
+			inStatus: 404,
+			inTask:   builtin.NewHTTP("test").Get(server.URL + "?status=${input.status}").ExpectStatus("200-299").Build(),
+			wantErr:  &builtin.HTTPError{Status: 404},
+		},
+		{
+			name:     "unexpected status with body",
+			inStatus: 500,
+			inTask:   newTask("2xx", "400-499"),
+			wantErr: &builtin.HTTPError{
+				Status: 500,
+				Body:   map[string]any{"error": "oops"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := tt.inTask.Execute(context.Background(), o.NewInput(map[string]any{"status": tt.inStatus}))
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Err: %v", err)
+				}
+				if output["status"] != tt.wantStatus {
+					t.Fatalf("Status: Got (%v) != Want (%v)", output["status"], tt.wantStatus)
+				}
+				return
+			}
+
+			var gotErr *builtin.HTTPError
+			if !errors.As(err, &gotErr) {
+				t.Fatalf("Err: Got (%v) != Want (%v)", err, tt.wantErr)
+			}
+			if gotErr.Status != tt.wantErr.Status || fmt.Sprint(gotErr.Body) != fmt.Sprint(tt.wantErr.Body) {
+				t.Fatalf("Err: Got (%+v) != Want (%+v)", gotErr, tt.wantErr)
+			}
+		})
+	}
+
+	_, err := o.Construct(map[string]any{
+		"name": "test",
+		"type": "http",
+		"input": map[string]any{
+			"method":        "GET",
+			"uri":           server.URL,
+			"expect_status": []any{"6xx"},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), `bad expected status "6xx"`) {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, `bad expected status "6xx"`)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestHTTP_Client(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			w.Header().Set("Location", "/")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // Suppress TLS handshake errors.
+	server.StartTLS()
+	defer server.Close()
+
+	r := o.NewRegistry()
+	builtin.MustRegisterHTTP(r)
+
+	// The default profile uses the transport of the test server.
+	r.SetHTTPClientFactory("", func() (*http.Client, error) {
+		return server.Client(), nil
+	})
+	// The profile "stub" never goes to the network.
+	var stubbed string
+	r.SetHTTPClientFactory("stub", func() (*http.Client, error) {
+		return &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			stubbed = req.URL.String()
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"text/plain"}},
+				Body:       io.NopCloser(strings.NewReader("stubbed")),
+				Request:    req,
+			}, nil
+		})}, nil
+	})
+
+	construct := func(yaml string) (o.Task, error) {
+		return r.ConstructFromYAML([]byte(fmt.Sprintf(yaml, server.URL)))
+	}
+
+	tests := []struct {
+		name       string
+		inYAML     string
+		wantStatus int
+		wantBody   any
+		wantErr    string
+	}{
+		{
+			name: "default profile",
+			inYAML: `
+name: test
+type: http
+input:
+  method: GET
+  uri: %s/redirect
+`,
+			wantStatus: 200,
+			wantBody:   "ok",
+		},
+		{
+			name: "named profile",
+			inYAML: `
+name: test
+type: http
+input:
+  client: stub
+  method: GET
+  uri: %s
+`,
+			wantStatus: 200,
+			wantBody:   "stubbed",
+		},
+		{
+			name: "no redirects",
+			inYAML: `
+name: test
+type: http
+input:
+  max_redirects: 0
+  method: GET
+  uri: %s/redirect
+`,
+			wantStatus: 302,
+			wantBody:   "",
+		},
+		{
+			name: "unknown profile",
+			inYAML: `
+name: test
+type: http
+input:
+  client: unknown
+  method: GET
+  uri: %s
+`,
+			wantErr: `http client profile "unknown" is not found`,
+		},
+		{
+			name: "skip verify with a non-standard transport",
+			inYAML: `
+name: test
+type: http
+input:
+  client: stub
+  insecure_skip_verify: true
+  method: GET
+  uri: %s
+`,
+			wantErr: "insecure_skip_verify requires an *http.Transport, but got builtin_test.roundTripperFunc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task, err := construct(tt.inYAML)
+			if err != nil {
+				if err.Error() != tt.wantErr {
+					t.Fatalf("Err: Got (%q) != Want (%q)", err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if tt.wantErr != "" {
+				t.Fatalf("Err: Got (nil) != Want (%q)", tt.wantErr)
+			}
+
+			output, err := task.Execute(context.Background(), o.NewInput(nil))
+			if err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if output["status"] != tt.wantStatus || output["body"] != tt.wantBody {
+				t.Fatalf("Output: Got (%v, %v) != Want (%v, %v)", output["status"], output["body"], tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+	if stubbed != server.URL {
+		t.Fatalf("Stubbed: Got (%q) != Want (%q)", stubbed, server.URL)
+	}
+
+	// The server certificate is not trusted by default, unless the
+	// verification is skipped.
+	if _, err := builtin.NewHTTP("test").Get(server.URL).Build().Execute(context.Background(), o.NewInput(nil)); err == nil {
+		t.Fatal("Err: Got (nil) != Want (certificate error)")
+	}
+	if _, err := builtin.NewHTTP("test").Get(server.URL).InsecureSkipVerify().Build().Execute(context.Background(), o.NewInput(nil)); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+}
+
+func TestHTTP_MaxResponseBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("x", 10)
+		switch r.URL.Path {
+		case "/chunked":
+			// Flushing makes the body chunked, without Content-Length.
+			_, _ = w.Write([]byte(body[:5]))
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(body[5:]))
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(body))
+		case "/large-error":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(strings.Repeat("x", 1<<20)))
+		default:
+			_, _ = w.Write([]byte(body))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		inPath   string
+		inMax    int64
+		wantBody string
+		wantErr  string
+	}{
+		{
+			name:     "no limit",
+			inPath:   "/",
+			wantBody: "xxxxxxxxxx",
+		},
+		{
+			name:     "exactly the limit",
+			inPath:   "/chunked",
+			inMax:    10,
+			wantBody: "xxxxxxxxxx",
+		},
+		{
+			name:    "content length too large",
+			inPath:  "/",
+			inMax:   5,
+			wantErr: "response body too large: exceeds 5 bytes",
+		},
+		{
+			name:    "chunked body too large",
+			inPath:  "/chunked",
+			inMax:   8,
+			wantErr: "response body too large: exceeds 8 bytes",
+		},
+		{
+			name:    "error body truncated",
+			inPath:  "/error",
+			inMax:   3,
+			wantErr: "unexpected status 500 Internal Server Error: xxx",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := builtin.NewHTTP("test").
+				Get(server.URL + tt.inPath).
+				ExpectStatus("2xx").
+				MaxResponseBytes(tt.inMax).
+				Build()
+			output, err := task.Execute(context.Background(), o.NewInput(nil))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Err: Got (%v) != Want (%q)", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if output["body"] != tt.wantBody {
+				t.Fatalf("Body: Got (%v) != Want (%v)", output["body"], tt.wantBody)
+			}
+		})
+	}
+
+	if _, err := builtin.NewHTTP("test").Get(server.URL).MaxResponseBytes(5).Build().Execute(context.Background(), o.NewInput(nil)); !errors.Is(err, builtin.ErrResponseTooLarge) {
+		t.Fatalf("Err: Got (%v) != Want (%v)", err, builtin.ErrResponseTooLarge)
+	}
+
+	// The body of an error response is always bounded, even without a limit.
+	_, err := builtin.NewHTTP("test").Get(server.URL+"/large-error").ExpectStatus("2xx").Build().Execute(context.Background(), o.NewInput(nil))
+	var httpErr *builtin.HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Err: Got (%v) != Want (HTTPError)", err)
+	}
+	if body, _ := httpErr.Body.(string); len(body) != 64<<10 {
+		t.Fatalf("Body: Got (%d bytes) != Want (%d bytes)", len(body), 64<<10)
+	}
+}
+
+func TestHTTP_ResponseMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data":"large"}`))
+		case http.MethodPost:
+			// Echo the request body.
+			_, _ = io.Copy(w, r.Body)
+		}
+	}))
+	defer server.Close()
+
+	// File mode.
+	output, err := builtin.NewHTTP("test").Get(server.URL).ResponseMode(builtin.ResponseModeFile).Build().Execute(context.Background(), o.NewInput(nil))
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	file := output["body"].(map[string]any)
+	path := file["path"].(string)
+	defer os.Remove(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if string(data) != `{"data":"large"}` || file["size"] != int64(len(data)) {
+		t.Fatalf("File: Got (%q, %v) != Want (%q, %d)", data, file["size"], `{"data":"large"}`, len(data))
+	}
+
+	// Reader mode, where the body is consumed by another task.
+	event := o.TraceTask(context.Background(), builtin.NewHTTP("test").Get(server.URL).ResponseMode(builtin.ResponseModeReader).Build(), o.NewInput(nil))
+	if event.Error != nil {
+		t.Fatalf("Err: %v", event.Error)
+	}
+	reader, ok := event.Output["body"].(io.ReadCloser)
+	if !ok {
+		t.Fatalf("Body: Got (%T) != Want (io.ReadCloser)", event.Output["body"])
+	}
+	// The reader is recorded as a placeholder in traces.
+	data, err = json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := `"body":"\u003cReader\u003e"`; !strings.Contains(string(data), want) {
+		t.Fatalf("Event: Got (%s) != Want (containing %s)", data, want)
+	}
+
+	task, err := o.Construct(map[string]any{
+		"name": "upload",
+		"type": "http",
+		"input": map[string]any{
+			"method":   "POST",
+			"uri":      server.URL,
+			"encoding": "text",
+			"body":     "${input.reader}",
+			"raw_body": true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	output, err = task.Execute(context.Background(), o.NewInput(map[string]any{"reader": reader}))
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if output["body"] != `{"data":"large"}` {
+		t.Fatalf("Body: Got (%v) != Want (%v)", output["body"], `{"data":"large"}`)
+	}
+
+	// Bad mode.
+	_, err = o.Construct(map[string]any{
+		"name": "test",
+		"type": "http",
+		"input": map[string]any{
+			"method":        "GET",
+			"uri":           server.URL,
+			"response_mode": "memory",
+		},
+	})
+	if err == nil || err.Error() != `bad response mode "memory"` {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, `bad response mode "memory"`)
+	}
+}
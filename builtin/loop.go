@@ -47,7 +47,7 @@ func (l *Loop) Execute(ctx context.Context, input orchestrator.Input) (orchestra
 	trace := orchestrator.TraceFromContext(ctx).New(l.Name)
 	ctx = orchestrator.ContextWithTrace(ctx, trace)
 
-	iterOutput, err := trace.Wrap(l.Input.Iterator).Execute(ctx, input)
+	iterOutput, err := trace.Wrap(orchestrator.Instrument(l.Input.Iterator)).Execute(ctx, input)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +67,7 @@ func (l *Loop) Execute(ctx context.Context, input orchestrator.Input) (orchestra
 		}
 		// Set the output of the iterator task for the current iteration.
 		input.Add(iterName, result.Output)
-		o, err := trace.Wrap(l.Input.Body).Execute(ctx, input)
+		o, err := trace.Wrap(orchestrator.Instrument(l.Input.Body)).Execute(orchestrator.ContextWithIteration(ctx, i), input)
 		if err != nil {
 			return nil, err
 		}
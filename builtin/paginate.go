@@ -0,0 +1,427 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+const (
+	TypeHTTPPaginate = "http_paginate"
+)
+
+type PaginateMode string
+
+const (
+	// PaginateCursor gets the cursor of the next page from the current page
+	// (typically from the response body).
+	PaginateCursor PaginateMode = "cursor"
+	// PaginatePage increments the page number by one for each page.
+	PaginatePage PaginateMode = "page"
+	// PaginateOffset increments the offset by the page size for each page.
+	PaginateOffset PaginateMode = "offset"
+	// PaginateLink follows the URL of the next page specified by the Link
+	// header (RFC 5988), i.e. `Link: <https://...>; rel="next"`. To avoid
+	// leaking credentials, a link to another origin (i.e. a different scheme
+	// or host) results in an error.
+	PaginateLink PaginateMode = "link"
+)
+
+func init() {
+	MustRegisterHTTPPaginate(orchestrator.GlobalRegistry)
+}
+
+func MustRegisterHTTPPaginate(r *orchestrator.Registry) {
+	r.MustRegister(&orchestrator.TaskFactory{
+		Type: TypeHTTPPaginate,
+		New:  func() orchestrator.Task { return new(HTTPPaginate) },
+	})
+}
+
+// PaginateOptions are the options for paginating through a list API.
+//
+// All the expressions are evaluated against the input environment, in which
+// the pagination state is available as the output of the task. For example,
+// for a task named "list_users":
+//
+//	list_users.index: the index of the current page, starting from 0
+//	list_users.cursor: the cursor of the current page (cursor mode)
+//	list_users.page: the page number of the current page (page mode)
+//	list_users.offset: the offset of the current page (offset mode)
+//
+// After a page is received, the response (i.e. status, header and body) will
+// also be available, e.g. "${list_users.body.next_cursor}".
+type PaginateOptions struct {
+	Mode PaginateMode `json:"mode"`
+	// Param is the query parameter carrying the cursor, the page number or
+	// the offset, which defaults to the mode name. To send the state in other
+	// ways (e.g. in the request body), set Param to "-" and use expressions
+	// in the request instead.
+	Param string `json:"param"`
+	// Cursor is the expression for getting the cursor of the next page. An
+	// empty cursor means that there are no more pages.
+	Cursor string `json:"cursor"`
+	// Start is the first page number (defaults to 1) or offset (defaults to 0).
+	Start *int `json:"start"`
+	// Step is the page size in the offset mode. It defaults to the number of
+	// items of the current page.
+	Step int `json:"step"`
+
+	// Items is the expression for getting the items (a list) from a page. If
+	// specified, the iterator will emit each item as {"value": item}, and an
+	// empty page will end the iteration. Otherwise, the iterator will emit
+	// each page as a whole, i.e. the response along with the pagination state.
+	Items string `json:"items"`
+	// Stop is the expression for deciding whether to stop after the current
+	// page.
+	Stop string `json:"stop"`
+	// MaxPages is the maximum number of pages to fetch. Zero means no limit.
+	MaxPages int `json:"max_pages"`
+}
+
+func (o PaginateOptions) validate() error {
+	switch o.Mode {
+	case PaginateCursor:
+		if o.Cursor == "" {
+			return fmt.Errorf("cursor is required in the cursor mode")
+		}
+	case PaginatePage, PaginateOffset:
+		if o.Items == "" && o.Stop == "" && o.MaxPages <= 0 {
+			return fmt.Errorf("one of items, stop and max_pages is required in the %s mode", o.Mode)
+		}
+		if o.Mode == PaginateOffset && o.Items == "" && o.Step <= 0 {
+			return fmt.Errorf("either items or step is required in the offset mode")
+		}
+	case PaginateLink:
+	default:
+		return fmt.Errorf(`bad paginate mode: must be one of [%q, %q, %q, %q]`, PaginateCursor, PaginatePage, PaginateOffset, PaginateLink)
+	}
+	return nil
+}
+
+func (o PaginateOptions) param() string {
+	if o.Param == "" {
+		return string(o.Mode)
+	}
+	return o.Param
+}
+
+func (o PaginateOptions) start() int {
+	switch {
+	case o.Start != nil:
+		return *o.Start
+	case o.Mode == PaginatePage:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// HTTPPaginate is a leaf task that is used to page through a list API over
+// HTTP. It returns an iterator over all the pages or items, and is always used
+// along with a Loop task.
+//
+// Each page is requested just like an HTTP task, which means that HTTPPaginate
+// accepts all the input of HTTP, along with the pagination options.
+type HTTPPaginate struct {
+	orchestrator.TaskHeader
+
+	Input struct {
+		HTTPInput
+		Paginate PaginateOptions `json:"paginate"`
+	} `json:"input"`
+
+	http *HTTP
+}
+
+func (p *HTTPPaginate) Init(r *orchestrator.Registry) error {
+	if err := p.Input.Paginate.validate(); err != nil {
+		return err
+	}
+	p.http = &HTTP{TaskHeader: p.TaskHeader, Input: p.Input.HTTPInput}
+	return p.http.Init(r)
+}
+
+func (p *HTTPPaginate) String() string {
+	return orchestrator.Redact(fmt.Sprintf(
+		"%s(name:%s, timeout:%s, request:%s %v, paginate:%s)",
+		p.Type,
+		p.Name,
+		p.Timeout,
+		p.Input.Method.Expr,
+		p.Input.URI.Expr,
+		p.Input.Paginate.Mode,
+	))
+}
+
+func (p *HTTPPaginate) Execute(ctx context.Context, input orchestrator.Input) (orchestrator.Output, error) {
+	// Take a snapshot of the input environment, which may be changed while
+	// paginating (e.g. by the body of a Loop task).
+	env := make(map[string]any)
+	for k, v := range input.Env() {
+		env[k] = v
+	}
+
+	iterator := orchestrator.NewIterator(ctx, func(sender *orchestrator.IteratorSender) {
+		defer sender.End() // End the iteration
+
+		if err := p.paginate(ctx, env, sender); err != nil {
+			sender.Send(nil, err)
+		}
+	})
+	return orchestrator.Output{"iterator": iterator}, nil
+}
+
+func (p *HTTPPaginate) paginate(ctx context.Context, env map[string]any, sender *orchestrator.IteratorSender) error {
+	opts := p.Input.Paginate
+
+	var (
+		value  = opts.start() // The page number or the offset.
+		cursor string
+		next   *url.URL
+	)
+
+	for i := 0; opts.MaxPages <= 0 || i < opts.MaxPages; i++ {
+		state := map[string]any{"index": i}
+		switch opts.Mode {
+		case PaginateCursor:
+			state["cursor"] = cursor
+		case PaginatePage, PaginateOffset:
+			state[string(opts.Mode)] = value
+		}
+
+		data := make(map[string]any, len(env)+1)
+		for k, v := range env {
+			data[k] = v
+		}
+		data[p.Name] = state
+		input := orchestrator.Input{Evaluator: orchestrator.NewEvaluatorWithData(data)}
+
+		req, auth, err := p.http.newRequest(ctx, input)
+		if err != nil {
+			return err
+		}
+		switch {
+		case opts.Mode == PaginateLink:
+			if next != nil {
+				req.URL, req.Host = next, ""
+			}
+		case opts.param() == "-":
+		case opts.Mode == PaginateCursor:
+			if cursor != "" {
+				setQuery(req, opts.param(), cursor)
+			}
+		default:
+			setQuery(req, opts.param(), value)
+		}
+
+		output, err := p.http.do(ctx, req, auth)
+		if err != nil {
+			return err
+		}
+		for k, v := range output {
+			state[k] = v
+		}
+
+		// Emit the items or the page.
+		var items []any
+		if opts.Items != "" {
+			expr := orchestrator.Expr[[]any]{Expr: opts.Items}
+			if items, err = expr.EvaluateX(input); err != nil {
+				return err
+			}
+			for _, item := range items {
+				if continue_ := sender.Send(orchestrator.Output{"value": item}, nil); !continue_ {
+					return nil
+				}
+			}
+			if len(items) == 0 {
+				return nil
+			}
+		} else {
+			if continue_ := sender.Send(state, nil); !continue_ {
+				return nil
+			}
+		}
+
+		if opts.Stop != "" {
+			expr := orchestrator.Expr[bool]{Expr: opts.Stop}
+			stop, err := expr.EvaluateX(input)
+			if err != nil {
+				return err
+			}
+			if stop {
+				return nil
+			}
+		}
+
+		// Move to the next page.
+		switch opts.Mode {
+		case PaginateCursor:
+			v, err := input.Evaluate(opts.Cursor)
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				return nil
+			}
+			if cursor = fmt.Sprintf("%v", v); cursor == "" {
+				return nil
+			}
+		case PaginatePage:
+			value++
+		case PaginateOffset:
+			if opts.Step > 0 {
+				value += opts.Step
+			} else {
+				value += len(items)
+			}
+		case PaginateLink:
+			header, _ := output["header"].(http.Header)
+			if next = nextLink(header, req.URL); next == nil {
+				return nil
+			}
+			if !sameOrigin(next, req.URL) {
+				return fmt.Errorf("refusing to follow next link %q to another origin", next.Redacted())
+			}
+		}
+	}
+	return nil
+}
+
+func setQuery(req *http.Request, key string, value any) {
+	q := req.URL.Query()
+	q.Set(key, fmt.Sprintf("%v", value))
+	req.URL.RawQuery = q.Encode()
+}
+
+// sameOrigin reports whether the two URLs have the same scheme and host,
+// including the port.
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host)
+}
+
+// nextLink returns the URL of the next page from the Link header, if any.
+// Relative URLs are resolved against base.
+func nextLink(header http.Header, base *url.URL) *url.URL {
+	for _, v := range header.Values("Link") {
+		// Links are separated by commas, which may also appear in URLs.
+		var links []string
+		for _, part := range strings.Split(v, ",") {
+			if strings.HasPrefix(strings.TrimSpace(part), "<") || len(links) == 0 {
+				links = append(links, part)
+			} else {
+				links[len(links)-1] += "," + part
+			}
+		}
+
+		for _, link := range links {
+			link = strings.TrimSpace(link)
+			end := strings.Index(link, ">")
+			if !strings.HasPrefix(link, "<") || end < 0 {
+				continue
+			}
+			target, params := link[1:end], strings.Split(link[end+1:], ";")
+			for _, param := range params {
+				key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+				// The relation may be a space-separated list.
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						u, err := base.Parse(target)
+						if err != nil {
+							return nil
+						}
+						return u
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type HTTPPaginateBuilder struct {
+	task *HTTPPaginate
+}
+
+// NewHTTPPaginate creates a builder of HTTPPaginate, which requests each page
+// by using the given request.
+func NewHTTPPaginate(name string, request *HTTPBuilder) *HTTPPaginateBuilder {
+	task := &HTTPPaginate{
+		TaskHeader: orchestrator.TaskHeader{
+			Name: name,
+			Type: TypeHTTPPaginate,
+		},
+	}
+	task.Input.HTTPInput = request.task.Input
+	task.Timeout = request.task.Timeout
+	return &HTTPPaginateBuilder{task: task}
+}
+
+func (b *HTTPPaginateBuilder) Timeout(timeout time.Duration) *HTTPPaginateBuilder {
+	b.task.Timeout = timeout
+	return b
+}
+
+// Cursor sets the cursor mode, in which the cursor of the next page is got
+// by the given expression and sent as the given query parameter.
+func (b *HTTPPaginateBuilder) Cursor(param, expr string) *HTTPPaginateBuilder {
+	b.task.Input.Paginate.Mode = PaginateCursor
+	b.task.Input.Paginate.Param = param
+	b.task.Input.Paginate.Cursor = expr
+	return b
+}
+
+// Page sets the page mode, in which the page number starts from start.
+func (b *HTTPPaginateBuilder) Page(param string, start int) *HTTPPaginateBuilder {
+	b.task.Input.Paginate.Mode = PaginatePage
+	b.task.Input.Paginate.Param = param
+	b.task.Input.Paginate.Start = &start
+	return b
+}
+
+// Offset sets the offset mode, in which the offset starts from start and
+// increments by step. Zero step means the number of items of each page.
+func (b *HTTPPaginateBuilder) Offset(param string, start, step int) *HTTPPaginateBuilder {
+	b.task.Input.Paginate.Mode = PaginateOffset
+	b.task.Input.Paginate.Param = param
+	b.task.Input.Paginate.Start = &start
+	b.task.Input.Paginate.Step = step
+	return b
+}
+
+// Link sets the link mode, which follows the Link headers.
+func (b *HTTPPaginateBuilder) Link() *HTTPPaginateBuilder {
+	b.task.Input.Paginate.Mode = PaginateLink
+	return b
+}
+
+func (b *HTTPPaginateBuilder) Items(expr string) *HTTPPaginateBuilder {
+	b.task.Input.Paginate.Items = expr
+	return b
+}
+
+func (b *HTTPPaginateBuilder) Stop(expr string) *HTTPPaginateBuilder {
+	b.task.Input.Paginate.Stop = expr
+	return b
+}
+
+func (b *HTTPPaginateBuilder) MaxPages(n int) *HTTPPaginateBuilder {
+	b.task.Input.Paginate.MaxPages = n
+	return b
+}
+
+func (b *HTTPPaginateBuilder) Build() orchestrator.Task {
+	if err := b.task.Init(orchestrator.GlobalRegistry); err != nil {
+		panic(err)
+	}
+	return b.task
+}
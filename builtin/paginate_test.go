@@ -0,0 +1,221 @@
+package builtin_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	o "github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+	"github.com/google/go-cmp/cmp"
+)
+
+// newUserServer serves 5 users, in pages of 2 users at most.
+func newUserServer() *httptest.Server {
+	users := []any{"a", "b", "c", "d", "e"}
+	page := func(offset int) string {
+		var items []any
+		if offset < len(users) {
+			end := offset + 2
+			if end > len(users) {
+				end = len(users)
+			}
+			items = users[offset:end]
+		} else {
+			items = []any{}
+		}
+		data, _ := json.Marshal(items)
+		return string(data)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var body string
+		switch r.URL.Path {
+		case "/cursor":
+			offset, _ := strconv.Atoi(q.Get("after"))
+			next := ""
+			if offset+2 < len(users) {
+				next = strconv.Itoa(offset + 2)
+			}
+			body = fmt.Sprintf(`{"users": %s, "next": %q}`, page(offset), next)
+		case "/page":
+			n, _ := strconv.Atoi(q.Get("page"))
+			body = fmt.Sprintf(`{"users": %s}`, page((n-1)*2))
+		case "/offset":
+			offset, _ := strconv.Atoi(q.Get("offset"))
+			body = fmt.Sprintf(`{"users": %s}`, page(offset))
+		case "/link":
+			offset, _ := strconv.Atoi(q.Get("o"))
+			if offset+2 < len(users) {
+				w.Header().Add("Link", fmt.Sprintf(`</link?o=%d>; rel="next", </link?o=4>; rel="last"`, offset+2))
+			}
+			body = fmt.Sprintf(`{"users": %s}`, page(offset))
+		case "/external-link":
+			w.Header().Add("Link", `<https://example.com/link?o=2>; rel="next"`)
+			body = fmt.Sprintf(`{"users": %s}`, page(0))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestHTTPPaginate(t *testing.T) {
+	server := newUserServer()
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		inTask o.Task
+		want   []any
+	}{
+		{
+			name: "cursor",
+			inTask: builtin.NewHTTPPaginate("users", builtin.NewHTTP("").Get(server.URL+"/cursor")).
+				Cursor("after", "${users.body.next}").
+				Items("${users.body.users}").
+				Build(),
+			want: []any{"a", "b", "c", "d", "e"},
+		},
+		{
+			name: "page",
+			inTask: builtin.NewHTTPPaginate("users", builtin.NewHTTP("").Get(server.URL+"/page")).
+				Page("page", 1).
+				Items("${users.body.users}").
+				Build(),
+			want: []any{"a", "b", "c", "d", "e"},
+		},
+		{
+			name: "offset with stop",
+			inTask: builtin.NewHTTPPaginate("users", builtin.NewHTTP("").Get(server.URL+"/offset")).
+				Offset("offset", 0, 0).
+				Items("${users.body.users}").
+				Stop("${len(users.body.users) < 2}").
+				Build(),
+			want: []any{"a", "b", "c", "d", "e"},
+		},
+		{
+			name: "link with max pages",
+			inTask: builtin.NewHTTPPaginate("users", builtin.NewHTTP("").Get(server.URL+"/link")).
+				Link().
+				Items("${users.body.users}").
+				MaxPages(2).
+				Build(),
+			want: []any{"a", "b", "c", "d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := tt.inTask.Execute(context.Background(), o.NewInput(nil))
+			if err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			iterator, ok := output.Iterator()
+			if !ok {
+				t.Fatalf("Output: Got (%v) != Want (iterator)", output)
+			}
+
+			var got []any
+			for result := range iterator.Next() {
+				if result.Err != nil {
+					t.Fatalf("Err: %v", result.Err)
+				}
+				got = append(got, result.Output["value"])
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Fatalf("Diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
+
+func TestHTTPPaginate_Loop(t *testing.T) {
+	server := newUserServer()
+	defer server.Close()
+
+	flow, err := o.ConstructFromYAML([]byte(fmt.Sprintf(`
+name: test
+type: loop
+input:
+  iterator:
+    name: pages
+    type: http_paginate
+    input:
+      method: GET
+      uri: %s/link
+      expect_status: [2xx]
+      paginate:
+        mode: link
+  body:
+    name: count
+    type: code
+    input:
+      code: |
+        def _(env):
+            return {"count": len(env.pages.body.users), "page": env.pages.index}
+`, server.URL)))
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	output, err := flow.Execute(context.Background(), o.NewInput(nil))
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	want := o.Output{
+		"0":         map[string]any{"count": 2, "page": 0},
+		"1":         map[string]any{"count": 2, "page": 1},
+		"2":         map[string]any{"count": 1, "page": 2},
+		"iteration": 3,
+	}
+	if !cmp.Equal(output, want) {
+		t.Fatalf("Diff: %v", cmp.Diff(output, want))
+	}
+
+	// A next link to another origin is refused.
+	task := builtin.NewHTTPPaginate("users", builtin.NewHTTP("").Get(server.URL+"/external-link").BearerAuth("token")).
+		Link().
+		Items("${users.body.users}").
+		Build()
+	output, err = task.Execute(context.Background(), o.NewInput(nil))
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	iterator, _ := output.Iterator()
+	var got []any
+	var gotErr error
+	for result := range iterator.Next() {
+		if result.Err != nil {
+			gotErr = result.Err
+			break
+		}
+		got = append(got, result.Output["value"])
+	}
+	if !cmp.Equal(got, []any{"a", "b"}) {
+		t.Fatalf("Diff: %v", cmp.Diff(got, []any{"a", "b"}))
+	}
+	wantErr := `refusing to follow next link "https://example.com/link?o=2" to another origin`
+	if gotErr == nil || gotErr.Error() != wantErr {
+		t.Fatalf("Err: Got (%v) != Want (%q)", gotErr, wantErr)
+	}
+
+	// Bad options.
+	_, err = o.ConstructFromYAML([]byte(`
+name: test
+type: http_paginate
+input:
+  method: GET
+  uri: http://example.com
+  paginate:
+    mode: page
+`))
+	wantErr = "one of items, stop and max_pages is required in the page mode"
+	if err == nil || err.Error() != wantErr {
+		t.Fatalf("Err: Got (%v) != Want (%q)", err, wantErr)
+	}
+}
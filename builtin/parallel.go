@@ -66,7 +66,7 @@ func (p *Parallel) execute(ctx context.Context, input orchestrator.Input) (orche
 				Output: output,
 				Err:    err,
 			}
-		}(trace.Wrap(t))
+		}(trace.Wrap(orchestrator.Instrument(t)))
 	}
 
 	// Gather
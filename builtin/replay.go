@@ -0,0 +1,34 @@
+package builtin
+
+import (
+	"context"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+// ReplayTypes are the types of the leaf tasks, which have side effects or
+// depend on the outside world, and thus will be stubbed by Replay.
+//
+// Note that HTTPPaginate tasks are stubbed only to prevent live requests,
+// and will fail since their outputs are iterators (see orchestrator.Replay).
+// Wait tasks are not stubbed, since they only run within actors,
+// which never record events (see orchestrator.NewActorWithContext). Instead,
+// they interact with the outside world through the actor as usual.
+var ReplayTypes = []string{TypeHTTP, TypeHTTPPaginate, TypeGraphQL, TypeFunc}
+
+// Replay re-executes the given flow with the given input, while the leaf
+// tasks of ReplayTypes are stubbed to return their outputs recorded in the
+// event tree (typically produced by TraceFlow). See orchestrator.Replay for
+// details.
+func Replay(ctx context.Context, flow orchestrator.Task, input map[string]any, recorded orchestrator.Event) orchestrator.Event {
+	return orchestrator.Replay(ctx, flow, orchestrator.NewInput(input), recorded, ReplayTypes...)
+}
+
+// ReplayFlow is like Replay but loads the flow from the given loader.
+func ReplayFlow(ctx context.Context, loader, name string, input map[string]any, recorded orchestrator.Event) (orchestrator.Event, error) {
+	call, err := NewCall("call").Loader(loader).Task(name).Raw().Input(input).BuildError()
+	if err != nil {
+		return orchestrator.Event{}, err
+	}
+	return Replay(ctx, call.task, input, recorded), nil
+}
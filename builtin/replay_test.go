@@ -0,0 +1,210 @@
+package builtin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	o "github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+func TestReplay(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"score": 21}`))
+	}))
+	defer server.Close()
+
+	newFlow := func(code string) o.Task {
+		return builtin.NewSerial("flow").Tasks(
+			builtin.NewHTTP("get_score").Get(server.URL),
+			builtin.NewCode("compute").Code(code),
+		).Build()
+	}
+
+	recorded := o.TraceTask(context.Background(), newFlow(`
+def _(env):
+    return env.get_score.body.score * 2
+`), o.NewInput(nil))
+
+	// Persist and load the recorded event, just like in production.
+	data, err := json.Marshal(recorded)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	var loaded o.Event
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	event := builtin.Replay(context.Background(), newFlow(`
+def _(env):
+    return env.get_score.body.score * 3
+`), nil, loaded)
+
+	if event.Error != nil {
+		t.Fatalf("Err: %v", event.Error)
+	}
+	if hits != 1 {
+		t.Fatalf("Hits: Got (%d) != Want (1)", hits)
+	}
+	// Note that numbers in the loaded event have been decoded as float64.
+	if got := event.Output["result"]; got != float64(63) {
+		t.Fatalf("Result: Got (%v) != Want (63)", got)
+	}
+}
+
+func TestReplay_GraphQL(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data": {"user": {"name": "bob"}}}`))
+	}))
+	defer server.Close()
+
+	flow := builtin.NewSerial("flow").Tasks(
+		builtin.NewGraphQL("get_user").Endpoint(server.URL).Query(`{ user { name } }`),
+		builtin.NewCode("greet").Code(`
+def _(env):
+    return "hello, " + env.get_user.user.name
+`),
+	).Build()
+
+	recorded := o.TraceTask(context.Background(), flow, o.NewInput(nil))
+	if recorded.Error != nil {
+		t.Fatalf("Err: %v", recorded.Error)
+	}
+
+	event := builtin.Replay(context.Background(), flow, nil, recorded)
+	if event.Error != nil {
+		t.Fatalf("Err: %v", event.Error)
+	}
+	if hits != 1 {
+		t.Fatalf("Hits: Got (%d) != Want (1)", hits)
+	}
+	if got := event.Output["result"]; got != "hello, bob" {
+		t.Fatalf("Result: Got (%v) != Want (hello, bob)", got)
+	}
+}
+
+func TestReplay_HTTPPaginate(t *testing.T) {
+	server := newUserServer()
+	defer server.Close()
+
+	var hits int
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		handler.ServeHTTP(w, r)
+	})
+
+	flow := builtin.NewLoop("loop").
+		Iterator(builtin.NewHTTPPaginate("users", builtin.NewHTTP("").Get(server.URL+"/link")).Link()).
+		Body(builtin.NewCode("count").Code(`
+def _(env):
+    return len(env.users.body.users)
+`)).
+		Build()
+
+	recorded := o.TraceTask(context.Background(), flow, o.NewInput(nil))
+	if recorded.Error != nil {
+		t.Fatalf("Err: %v", recorded.Error)
+	}
+	if hits != 3 {
+		t.Fatalf("Hits: Got (%d) != Want (3)", hits)
+	}
+
+	// Persist and load the recorded event, just like in production.
+	data, err := json.Marshal(recorded)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	var loaded o.Event
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	for _, event := range []o.Event{recorded, loaded} {
+		event = builtin.Replay(context.Background(), flow, nil, event)
+		wantErr := `recorded output of task "loop/users" is an iterator, which can not be replayed`
+		if event.Error == nil || !strings.Contains(event.Error.Error(), wantErr) {
+			t.Fatalf("Err: Got (%v) != Want (%q)", event.Error, wantErr)
+		}
+		// No live requests are sent.
+		if hits != 3 {
+			t.Fatalf("Hits: Got (%d) != Want (3)", hits)
+		}
+	}
+}
+
+func TestReplay_Wait(t *testing.T) {
+	flow, err := o.Construct(map[string]any{
+		"name": "flow",
+		"type": builtin.TypeSerial,
+		"input": map[string]any{
+			"async": true,
+			"tasks": []map[string]any{
+				{
+					"name": "ask",
+					"type": builtin.TypeWait,
+					"input": map[string]any{
+						"output": map[string]any{"question": "what's your name?"},
+					},
+				},
+				{
+					"name": "reply",
+					"type": builtin.TypeCode,
+					"input": map[string]any{
+						"code": `
+def _(env):
+    return "hello, " + env.ask.input.name
+`,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	// talk drives the actor of the flow to the end.
+	talk := func(event o.Event) o.Output {
+		if event.Error != nil {
+			t.Fatalf("Err: %v", event.Error)
+		}
+		actor, ok := o.Output(event.Output).Actor()
+		if !ok {
+			t.Fatalf("Output: Got (%v) != Want (actor)", event.Output)
+		}
+		defer actor.Stop()
+
+		if result := <-actor.Outbox(); result.Err != nil || result.Output["status"] != "pause" {
+			t.Fatalf("Result: Got (%v, %v) != Want (pause)", result.Output, result.Err)
+		}
+		actor.Inbox() <- map[string]any{"name": "bob"}
+		result := <-actor.Outbox()
+		if result.Err != nil {
+			t.Fatalf("Err: %v", result.Err)
+		}
+		return result.Output
+	}
+
+	recorded := o.TraceTask(context.Background(), flow, o.NewInput(nil))
+	if got := talk(recorded)["result"]; got != "hello, bob" {
+		t.Fatalf("Result: Got (%v) != Want (hello, bob)", got)
+	}
+
+	// The Wait task is not stubbed, and thus still interacts through the actor.
+	event := builtin.Replay(context.Background(), flow, nil, recorded)
+	if got := talk(event)["result"]; got != "hello, bob" {
+		t.Fatalf("Result: Got (%v) != Want (hello, bob)", got)
+	}
+}
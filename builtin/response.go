@@ -0,0 +1,114 @@
+package builtin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrResponseTooLarge is returned by an HTTP task when the response body
+// exceeds the limit (see the input "max_response_bytes").
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// ResponseMode determines how the body of a non-streamed response is made
+// into the output.
+type ResponseMode string
+
+const (
+	// ResponseModeDecode decodes the whole body in memory according to the
+	// Content-Type. This is the default mode.
+	ResponseModeDecode ResponseMode = "decode"
+	// ResponseModeFile saves the body to a temporary file, and outputs the
+	// body as {"path": ..., "size": ...}. The caller is responsible for
+	// removing the file.
+	ResponseModeFile ResponseMode = "file"
+	// ResponseModeReader outputs the body as an io.ReadCloser, which can be
+	// consumed lazily by later tasks (e.g. as the raw body of another HTTP
+	// task). The caller is responsible for closing the reader, and the
+	// reading is still subject to the timeout of the task. Such an output
+	// is never cached, and the body is recorded as "<Reader>" in traces.
+	ResponseModeReader ResponseMode = "reader"
+)
+
+func (m ResponseMode) validate() error {
+	switch m {
+	case "", ResponseModeDecode, ResponseModeFile, ResponseModeReader:
+		return nil
+	default:
+		return fmt.Errorf("bad response mode %q", m)
+	}
+}
+
+// responseReader is the body of a response in the reader mode, which is
+// serialized as a placeholder (e.g. in traces) since it's consumed lazily.
+type responseReader struct {
+	io.ReadCloser
+}
+
+func (r responseReader) String() string {
+	return "<Reader>"
+}
+
+func (r responseReader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func responseTooLarge(limit int64) error {
+	return fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, limit)
+}
+
+// limitedBody is a response body which fails with ErrResponseTooLarge once
+// more than limit bytes have been read. Unlike io.LimitedReader, it tells an
+// oversized body from one of exactly limit bytes.
+type limitedBody struct {
+	io.ReadCloser
+	n     int64 // The number of bytes remaining
+	limit int64
+}
+
+func newLimitedBody(body io.ReadCloser, limit int64) *limitedBody {
+	return &limitedBody{ReadCloser: body, n: limit, limit: limit}
+}
+
+func (b *limitedBody) Read(p []byte) (n int, err error) {
+	if b.n < 0 {
+		return 0, responseTooLarge(b.limit)
+	}
+	// Read at most one more byte than allowed to detect an oversized body.
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err = b.ReadCloser.Read(p)
+	if int64(n) <= b.n {
+		b.n -= int64(n)
+		return n, err
+	}
+	n = int(b.n)
+	b.n = -1
+	return n, responseTooLarge(b.limit)
+}
+
+// saveBody saves the body to a temporary file, which will be removed if any
+// error occurs.
+func saveBody(body io.Reader) (map[string]any, error) {
+	f, err := os.CreateTemp("", "orchestrator-http-*")
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+
+	return map[string]any{
+		"path": f.Name(),
+		"size": size,
+	}, nil
+}
@@ -0,0 +1,223 @@
+package builtin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule describes when a job runs.
+type Schedule interface {
+	// Next returns the next activation time later than t, or the zero time
+	// if there is none.
+	Next(t time.Time) time.Time
+}
+
+// Every returns a schedule that activates once every interval d.
+func Every(d time.Duration) Schedule {
+	return everySchedule(d)
+}
+
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a schedule specification, which is either:
+//
+//   - a standard cron expression with five fields (minute, hour, day of month,
+//     month and day of week), e.g. "*/15 9-17 * * mon-fri";
+//   - a predefined descriptor, e.g. "@hourly" or "@daily";
+//   - a fixed interval, e.g. "@every 1m30s".
+//
+// Cron expressions are evaluated in the local time zone.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, fmt.Errorf("bad schedule %q: %v", spec, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("bad schedule %q: interval must be positive", spec)
+		}
+		return Every(interval), nil
+	}
+	if expr, ok := cronDescriptors[spec]; ok {
+		spec = expr
+	}
+	return ParseCron(spec)
+}
+
+// cronField describes the range and the names of a cron field.
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Both 0 and 7 stand for Sunday.
+	cronDow = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// cronSchedule is a schedule parsed from a cron expression, in which each
+// field is a bit set of the allowed values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// Whether the day of month or the day of week is restricted (i.e. not
+	// starting with "*", as in vixie cron, so that "*/n" is unrestricted).
+	domRestricted, dowRestricted bool
+}
+
+// ParseCron parses a standard cron expression with five fields. Each field
+// supports "*", single values, ranges ("a-b"), steps ("*/n", "a-b/n" or "a/n")
+// and lists separated by commas. Names are allowed for months ("jan"-"dec")
+// and days of week ("sun"-"sat").
+func ParseCron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("bad cron expression %q: want 5 fields but got %d", expr, len(fields))
+	}
+
+	var s cronSchedule
+	var err error
+	for i, f := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&s.minute, cronMinute},
+		{&s.hour, cronHour},
+		{&s.dom, cronDom},
+		{&s.month, cronMonth},
+		{&s.dow, cronDow},
+	} {
+		if *f.bits, err = parseCronField(fields[i], f.field); err != nil {
+			return nil, fmt.Errorf("bad cron expression %q: %v", expr, err)
+		}
+	}
+
+	// Sunday can be either 0 or 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domRestricted = !strings.HasPrefix(fields[2], "*")
+	s.dowRestricted = !strings.HasPrefix(fields[4], "*")
+
+	return &s, nil
+}
+
+func parseCronField(s string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if r, st, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(st)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q of %s", st, f.name)
+			}
+			rng, step = r, n
+		}
+
+		var start, end int
+		switch {
+		case rng == "*":
+			start, end = f.min, f.max
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if start, err = parseCronValue(a, f); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(b, f); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseCronValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			start, end = v, v
+			if step > 1 {
+				// "a/n" means from a to the maximum, every n.
+				end = f.max
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("bad range %q of %s", rng, f.name)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, f cronField) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("bad value %q of %s: must be within [%d, %d]", s, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// Start from the next whole minute.
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+
+	// Give up if no time matches within five years (e.g. "0 0 30 2 *").
+	yearLimit := t.Year() + 5
+	for t.Year() <= yearLimit {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchDay follows the convention of cron: if both the day of month and the
+// day of week are restricted, a day matches if either of them matches.
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	domMatched := s.dom&(1<<uint(t.Day())) != 0
+	dowMatched := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return domMatched || dowMatched
+	}
+	return domMatched && dowMatched
+}
@@ -0,0 +1,90 @@
+package builtin_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// 2024-01-31 is a Wednesday.
+	from := time.Date(2024, 1, 31, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		inSpec   string
+		wantNext time.Time
+		wantErr  bool
+	}{
+		{
+			inSpec:   "* * * * *",
+			wantNext: time.Date(2024, 1, 31, 10, 31, 0, 0, time.UTC),
+		},
+		{
+			inSpec:   "*/15 9-17 * * mon-fri",
+			wantNext: time.Date(2024, 1, 31, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			inSpec:   "0 9 * * sat,sun",
+			wantNext: time.Date(2024, 2, 3, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			// Either the day of month or the day of week matches.
+			inSpec:   "0 0 15 * 5",
+			wantNext: time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// A day of month starting with "*" is unrestricted, thus both
+			// fields must match.
+			inSpec:   "0 0 */2 * mon",
+			wantNext: time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			inSpec:   "0 0 29 feb *",
+			wantNext: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			inSpec:   "30 10 * * 7",
+			wantNext: time.Date(2024, 2, 4, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			inSpec:   "@monthly",
+			wantNext: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			inSpec:   "@every 1m30s",
+			wantNext: from.Add(90 * time.Second),
+		},
+		{
+			inSpec:   "0 0 30 2 *",
+			wantNext: time.Time{},
+		},
+		{
+			inSpec:  "60 * * * *",
+			wantErr: true,
+		},
+		{
+			inSpec:  "* * * *",
+			wantErr: true,
+		},
+		{
+			inSpec:  "@every -1s",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.inSpec, func(t *testing.T) {
+			s, err := builtin.ParseSchedule(tt.inSpec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Err: Got (%v), WantErr (%v)", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := s.Next(from); !got.Equal(tt.wantNext) {
+				t.Fatalf("Next: Got (%s) != Want (%s)", got, tt.wantNext)
+			}
+		})
+	}
+}
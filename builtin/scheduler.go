@@ -0,0 +1,400 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+// OverlapPolicy decides what to do when a job is due while its previous run
+// is still in progress.
+type OverlapPolicy string
+
+const (
+	// OverlapSkip skips the new run. This is the default policy.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue delays the new run until the previous runs finish.
+	OverlapQueue OverlapPolicy = "queue"
+	// OverlapAllow starts the new run concurrently.
+	OverlapAllow OverlapPolicy = "allow"
+)
+
+// DefaultHistorySize is the default number of runs kept for each job.
+const DefaultHistorySize = 100
+
+// Job is a flow that runs on a schedule.
+type Job struct {
+	// The unique name of the job.
+	Name string
+	// Schedule is the schedule specification (see ParseSchedule).
+	Schedule string
+
+	// The flow to run, which is loaded from the loader, just like Call.
+	Loader string
+	Flow   string
+	// Input is the input of each run, which may contain expressions. The
+	// expressions are evaluated on each run, with the following environment:
+	//
+	//	schedule.job: the job name
+	//	schedule.time: the scheduled time of the run (in RFC 3339)
+	//	schedule.run: the sequence number of the run, starting from 1
+	Input map[string]any
+
+	// Overlap defaults to OverlapSkip.
+	Overlap OverlapPolicy
+}
+
+// Run is a record of a job run.
+type Run struct {
+	Job         string              `json:"job"`
+	Seq         int                 `json:"seq"`
+	ScheduledAt time.Time           `json:"scheduled_at"`
+	Start       time.Time           `json:"start"`
+	End         time.Time           `json:"end"`
+	Skipped     bool                `json:"skipped,omitempty"`
+	Output      orchestrator.Output `json:"output,omitempty"`
+	Error       error               `json:"error,omitempty"`
+}
+
+// Clock provides the current time and timers to the scheduler.
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a channel that will receive the current time after
+	// at least duration d, and a function to stop the timer.
+	NewTimer(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+// Scheduler runs flows on schedules (i.e. cron expressions or fixed intervals).
+type Scheduler struct {
+	// HistorySize is the number of runs kept for each job. Zero means
+	// DefaultHistorySize.
+	HistorySize int
+	// Clock is the clock used for scheduling, which must not be changed
+	// after the scheduler is started. Nil means the system clock.
+	Clock Clock
+
+	mu      sync.Mutex
+	jobs    map[string]*scheduledJob
+	ctx     context.Context // The base context of all runs.
+	cancel  context.CancelFunc
+	stop    chan struct{}
+	stopped bool
+
+	loops sync.WaitGroup
+	runs  sync.WaitGroup
+}
+
+type scheduledJob struct {
+	Job
+	schedule Schedule
+	removed  chan struct{}
+
+	mu      sync.Mutex
+	seq     int
+	running int
+	queued  []time.Time
+	history []Run
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		jobs: make(map[string]*scheduledJob),
+		stop: make(chan struct{}),
+	}
+}
+
+// Add adds a job. If the scheduler has been started, the job will be
+// scheduled immediately.
+func (s *Scheduler) Add(job Job) error {
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return err
+	}
+	switch job.Overlap {
+	case "":
+		job.Overlap = OverlapSkip
+	case OverlapSkip, OverlapQueue, OverlapAllow:
+	default:
+		return fmt.Errorf("bad overlap policy %q", job.Overlap)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return fmt.Errorf("scheduler has been stopped")
+	}
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job named %q already exists", job.Name)
+	}
+
+	j := &scheduledJob{
+		Job:      job,
+		schedule: schedule,
+		removed:  make(chan struct{}),
+	}
+	s.jobs[job.Name] = j
+	if s.ctx != nil {
+		s.startLoop(j)
+	}
+	return nil
+}
+
+// Remove removes the job of the given name. The in-progress runs, if any,
+// will not be affected.
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("job named %q is not found", name)
+	}
+	close(j.removed)
+	delete(s.jobs, name)
+	return nil
+}
+
+// Jobs returns all the jobs, ordered by their names.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []Job
+	for _, j := range s.jobs {
+		jobs = append(jobs, j.Job)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Name < jobs[k].Name })
+	return jobs
+}
+
+// History returns the recent runs of the job of the given name, from the
+// oldest to the newest.
+func (s *Scheduler) History(name string) ([]Run, error) {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("job named %q is not found", name)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Run(nil), j.history...), nil
+}
+
+// Start starts scheduling all the jobs. All runs will be executed with
+// contexts derived from ctx (see CallFlow), and will be cancelled if ctx
+// is cancelled.
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return fmt.Errorf("scheduler has been stopped")
+	}
+	if s.ctx != nil {
+		return fmt.Errorf("scheduler has already been started")
+	}
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	for _, j := range s.jobs {
+		s.startLoop(j)
+	}
+	return nil
+}
+
+// Stop stops scheduling new runs, and then waits for the in-progress runs
+// to finish. Queued runs are dropped. If ctx is done before all runs finish,
+// the remaining runs will be cancelled and ctx's error will be returned.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	close(s.stop)
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if cancel != nil {
+			cancel()
+		}
+		return nil
+	case <-ctx.Done():
+		if cancel != nil {
+			cancel()
+		}
+		<-done
+		return ctx.Err()
+	}
+}
+
+// startLoop must be called with s.mu held.
+func (s *Scheduler) startLoop(j *scheduledJob) {
+	s.loops.Add(1)
+	go func() {
+		defer s.loops.Done()
+		s.loop(j)
+	}()
+}
+
+func (s *Scheduler) loop(j *scheduledJob) {
+	clock := s.clock()
+	next := j.schedule.Next(clock.Now())
+	for !next.IsZero() {
+		c, stop := clock.NewTimer(next.Sub(clock.Now()))
+		select {
+		case <-s.stop:
+			stop()
+			return
+		case <-j.removed:
+			stop()
+			return
+		case <-c:
+		}
+
+		s.trigger(j, next)
+
+		// Skip the missed activations, if any.
+		now := clock.Now()
+		if next.Before(now) {
+			next = now
+		}
+		next = j.schedule.Next(next)
+	}
+}
+
+// trigger starts a run of the job according to its overlap policy.
+func (s *Scheduler) trigger(j *scheduledJob, scheduledAt time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.running > 0 {
+		switch j.Overlap {
+		case OverlapSkip:
+			j.seq++
+			j.record(s.historySize(), Run{
+				Job:         j.Name,
+				Seq:         j.seq,
+				ScheduledAt: scheduledAt,
+				Skipped:     true,
+			})
+			return
+		case OverlapQueue:
+			j.queued = append(j.queued, scheduledAt)
+			return
+		}
+	}
+
+	j.running++
+	s.runs.Add(1)
+	go func() {
+		defer s.runs.Done()
+		s.run(j, scheduledAt)
+	}()
+}
+
+// run runs the job, followed by the queued runs, if any.
+func (s *Scheduler) run(j *scheduledJob, scheduledAt time.Time) {
+	for {
+		j.mu.Lock()
+		j.seq++
+		seq := j.seq
+		j.mu.Unlock()
+
+		r := Run{
+			Job:         j.Name,
+			Seq:         seq,
+			ScheduledAt: scheduledAt,
+			Start:       s.clock().Now(),
+		}
+		r.Output, r.Error = s.execute(j, scheduledAt, seq)
+		r.End = s.clock().Now()
+
+		j.mu.Lock()
+		j.record(s.historySize(), r)
+
+		select {
+		case <-s.stop:
+			// Drop the queued runs.
+			j.queued = nil
+		default:
+		}
+		if len(j.queued) == 0 {
+			j.running--
+			j.mu.Unlock()
+			return
+		}
+		scheduledAt, j.queued = j.queued[0], j.queued[1:]
+		j.mu.Unlock()
+	}
+}
+
+func (s *Scheduler) execute(j *scheduledJob, scheduledAt time.Time, seq int) (orchestrator.Output, error) {
+	env := orchestrator.Input{Evaluator: orchestrator.NewEvaluatorWithData(map[string]any{
+		"schedule": map[string]any{
+			"job":  j.Name,
+			"time": scheduledAt.Format(time.RFC3339),
+			"run":  seq,
+		},
+	})}
+	value, err := orchestrator.Evaluate(j.Input, env.Evaluate)
+	if err != nil {
+		return nil, err
+	}
+	input, _ := value.(map[string]any)
+
+	ctx := orchestrator.ContextWithExecutionID(s.ctx, orchestrator.NewExecutionID())
+	output, err := CallFlow(ctx, j.Loader, j.Flow, input)
+	if err != nil {
+		orchestrator.Log(ctx, err, "scheduled run failed", "job", j.Name)
+	}
+	return output, err
+}
+
+func (s *Scheduler) clock() Clock {
+	if s.Clock != nil {
+		return s.Clock
+	}
+	return realClock{}
+}
+
+func (s *Scheduler) historySize() int {
+	if s.HistorySize > 0 {
+		return s.HistorySize
+	}
+	return DefaultHistorySize
+}
+
+// record must be called with j.mu held.
+func (j *scheduledJob) record(size int, r Run) {
+	j.history = append(j.history, r)
+	if n := len(j.history); n > size {
+		j.history = append([]Run(nil), j.history[n-size:]...)
+	}
+}
@@ -0,0 +1,139 @@
+package builtin_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScheduler(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	registerLoader(t, "scheduler_test", builtin.MapLoader{
+		"slow": map[string]any{
+			"name": "slow",
+			"type": builtin.TypeFunc,
+			"input": map[string]any{
+				"func": func(_ context.Context, input orchestrator.Input) (orchestrator.Output, error) {
+					started <- struct{}{}
+					<-release
+					return orchestrator.Output{"job": input.Get("input")["job"]}, nil
+				},
+			},
+		},
+	})
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := newFakeClock(t0)
+	s := builtin.NewScheduler()
+	s.Clock = clock
+	if err := s.Add(builtin.Job{
+		Name:     "report",
+		Schedule: "@every 1m",
+		Loader:   "scheduler_test",
+		Flow:     "slow",
+		Input:    map[string]any{"job": "${schedule.job}"},
+	}); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	// The first run starts and blocks.
+	<-clock.waiting
+	clock.Advance(time.Minute)
+	<-started
+
+	// The second run is skipped since the first one is still in progress.
+	<-clock.waiting
+	clock.Advance(time.Minute)
+	<-clock.waiting
+
+	close(release)
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	history, err := s.History("report")
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	want := []builtin.Run{
+		{
+			Job:         "report",
+			Seq:         2,
+			ScheduledAt: t0.Add(2 * time.Minute),
+			Skipped:     true,
+		},
+		{
+			Job:         "report",
+			Seq:         1,
+			ScheduledAt: t0.Add(time.Minute),
+			Start:       t0.Add(time.Minute),
+			End:         t0.Add(2 * time.Minute),
+			Output:      orchestrator.Output{"job": "report"},
+		},
+	}
+	if !cmp.Equal(history, want) {
+		t.Fatalf("Diff: %v", cmp.Diff(history, want))
+	}
+}
+
+// fakeClock is a clock whose time only changes when it is advanced.
+type fakeClock struct {
+	// waiting receives a value each time a timer is created.
+	waiting chan struct{}
+
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waiting: make(chan struct{})}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	timer := fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	c.mu.Unlock()
+
+	c.waiting <- struct{}{}
+	return timer.c, func() bool { return true }
+}
+
+// Advance advances the time by d, and fires all the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	var pending []fakeTimer
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.c <- c.now
+	}
+	c.timers = pending
+}
@@ -57,7 +57,7 @@ type Serial struct {
 		// The optional schema for the following series of subtasks.
 		//
 		// Typically, the schema is required for a standalone workflow.
-		Schema orchestrator.Schema `json:schema,omitempty`
+		Schema orchestrator.Schema `json:"schema,omitempty"`
 
 		Tasks []orchestrator.Task `json:"tasks"`
 	} `json:"input"`
@@ -84,7 +84,7 @@ func (s *Serial) Execute(ctx context.Context, input orchestrator.Input) (orchest
 	}
 
 	if s.Input.Async {
-		actor := orchestrator.NewActor(func(ctx context.Context, ab *orchestrator.ActorBehavior) {
+		actor := orchestrator.NewActorWithContext(ctx, func(ctx context.Context, ab *orchestrator.ActorBehavior) {
 			// Add the actor behavior into the input environment for later use.
 			input.Add("actor", map[string]any{"behavior": ab})
 
@@ -94,6 +94,9 @@ func (s *Serial) Execute(ctx context.Context, input orchestrator.Input) (orchest
 				return
 			}
 
+			// The actor has finished, and thus its execution will never be resumed.
+			orchestrator.CompleteCheckpoint(ctx)
+
 			output["status"] = "finish" // Mark the actor status as "finish".
 			ab.Send(output, nil)
 		})
@@ -108,7 +111,7 @@ func (s *Serial) execute(ctx context.Context, input orchestrator.Input) (output
 	ctx = orchestrator.ContextWithTrace(ctx, trace)
 
 	for _, t := range s.Input.Tasks {
-		output, err = trace.Wrap(t).Execute(ctx, input)
+		output, err = trace.Wrap(orchestrator.Instrument(t)).Execute(ctx, input)
 		if err != nil {
 			return nil, err
 		}
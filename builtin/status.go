@@ -0,0 +1,174 @@
+package builtin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+// HTTPError is returned by an HTTP task when the response status is not
+// expected (see the input "expect_status"). It carries the response, so that
+// the error can be inspected by using errors.As.
+type HTTPError struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	// Body is decoded according to the Content-Type, just like the body of
+	// a normal output.
+	Body any `json:"body"`
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("unexpected status %d %s", e.Status, http.StatusText(e.Status))
+
+	var body string
+	switch v := e.Body.(type) {
+	case nil:
+	case string:
+		body = v
+	default:
+		data, _ := json.Marshal(v)
+		body = string(data)
+	}
+	if body = strings.TrimSpace(body); body == "" {
+		return msg
+	}
+
+	// Keep the message short.
+	const maxLen = 256
+	if len(body) > maxLen {
+		body = body[:maxLen] + "..."
+	}
+	return msg + ": " + body
+}
+
+// Output returns the response as an output, which is the same as the output
+// of a successful HTTP task.
+func (e *HTTPError) Output() orchestrator.Output {
+	return orchestrator.Output{
+		"status": e.Status,
+		"header": e.Header,
+		"body":   e.Body,
+	}
+}
+
+// maxErrorBodyBytes is the maximum number of bytes read from the body of an
+// error response, regardless of the input "max_response_bytes".
+const maxErrorBodyBytes = 64 << 10
+
+// newHTTPError reads and decodes the response body, of which at most
+// maxErrorBodyBytes are read. The body is kept as a string if it can not
+// be decoded (e.g. it has been truncated).
+func newHTTPError(resp *http.Response, mediatype string) *HTTPError {
+	defer resp.Body.Close()
+
+	e := &HTTPError{Status: resp.StatusCode, Header: resp.Header}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if len(data) == 0 {
+		return e
+	}
+
+	e.Body = string(data)
+	if codec, ok := codecForMediaType(mediatype); ok {
+		var v any
+		if err := codec.Decode(bytes.NewReader(data), &v); err == nil {
+			e.Body = v
+		}
+	}
+	return e
+}
+
+// statusMatcher matches status codes against a list of ranges. An empty
+// matcher matches any status code.
+type statusMatcher []statusRange
+
+type statusRange struct {
+	min, max int
+}
+
+// parseStatusMatcher parses the expected statuses, each of which is either
+// a status code (e.g. 200 or "404"), a class of status codes (e.g. "2xx") or
+// a range of status codes (e.g. "200-299").
+func parseStatusMatcher(statuses []any) (statusMatcher, error) {
+	var m statusMatcher
+	for _, s := range statuses {
+		r, err := parseStatusRange(s)
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, r)
+	}
+	return m, nil
+}
+
+func parseStatusRange(status any) (statusRange, error) {
+	var s string
+	switch v := status.(type) {
+	case int:
+		s = strconv.Itoa(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		s = strings.ToLower(strings.TrimSpace(v))
+	default:
+		return statusRange{}, fmt.Errorf("bad expected status %v", status)
+	}
+
+	parse := func(code string) (int, error) {
+		n, err := strconv.Atoi(code)
+		if err != nil || n < 100 || n > 599 {
+			return 0, fmt.Errorf("bad expected status %q", s)
+		}
+		return n, nil
+	}
+
+	switch {
+	case len(s) == 3 && strings.HasSuffix(s, "xx"):
+		n, err := parse(s[:1] + "00")
+		if err != nil {
+			return statusRange{}, err
+		}
+		return statusRange{min: n, max: n + 99}, nil
+
+	case strings.Contains(s, "-"):
+		a, b, _ := strings.Cut(s, "-")
+		min, err := parse(strings.TrimSpace(a))
+		if err != nil {
+			return statusRange{}, err
+		}
+		max, err := parse(strings.TrimSpace(b))
+		if err != nil {
+			return statusRange{}, err
+		}
+		if min > max {
+			return statusRange{}, fmt.Errorf("bad expected status %q", s)
+		}
+		return statusRange{min: min, max: max}, nil
+
+	default:
+		n, err := parse(s)
+		if err != nil {
+			return statusRange{}, err
+		}
+		return statusRange{min: n, max: n}, nil
+	}
+}
+
+func (m statusMatcher) Match(status int) bool {
+	if len(m) == 0 {
+		return true
+	}
+	for _, r := range m {
+		if status >= r.min && status <= r.max {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package builtin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+// StreamOptions are the options for handling the events of a streamed
+// response, i.e. server-sent events or newline-delimited JSON.
+type StreamOptions struct {
+	// Decode is the way to decode the data of each event, which is either
+	// "text" (the default) or "json". In the "json" mode, the result of the
+	// filter expression, if any, is also kept as is (instead of being
+	// converted to a string).
+	Decode string `json:"decode"`
+	// Done is the sentinel data (e.g. "[DONE]") which ends the stream.
+	Done string `json:"done"`
+}
+
+func (o StreamOptions) validate() error {
+	switch o.Decode {
+	case "", "text", "json":
+		return nil
+	default:
+		return fmt.Errorf("bad stream decode %q", o.Decode)
+	}
+}
+
+// streamOutput makes the output of a streamed event by setting its data,
+// which is decoded and then filtered. It reports done if the data is the
+// sentinel, and returns a nil output if the event should be skipped.
+func (h *HTTP) streamOutput(output orchestrator.Output, data string) (_ orchestrator.Output, done bool, err error) {
+	opts := h.Input.Stream
+	if opts.Done != "" && strings.TrimSpace(data) == opts.Done {
+		return nil, true, nil
+	}
+
+	var value any = data
+	if opts.Decode == "json" {
+		if strings.TrimSpace(data) == "" {
+			return nil, false, nil
+		}
+		if err := (JSON{}).Decode(strings.NewReader(data), &value); err != nil {
+			return nil, false, fmt.Errorf("failed to decode event data: %v", err)
+		}
+	}
+	output["data"] = value
+
+	if filter := h.Input.SSEFilter; filter != "" {
+		evaluator := orchestrator.NewEvaluatorWithData(output)
+		value, err := evaluator.Evaluate(filter)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to evaluate '%s': %v", filter, err)
+		}
+		if opts.Decode == "json" {
+			output["data"] = value
+		} else {
+			// For compatibility, the result is converted to a string.
+			output["data"] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	return output, false, nil
+}
@@ -49,13 +49,19 @@ func (w *Wait) Execute(ctx context.Context, input orchestrator.Input) (orchestra
 		return nil, fmt.Errorf("task %q (of type Wait) must be used within an asynchronous flow", w.Name)
 	}
 
+	data := map[string]any{
+		"output":       w.Input.Output.Value,
+		"input_schema": w.Input.InputSchema,
+		"status":       "pause", // Mark the actor status as "pause".
+	}
+
+	// Record the pause, if checkpointing is enabled, to make the actor survive
+	// restarts. If the actor is being resumed at this task, the output value
+	// has already been sent before.
+	resumed := orchestrator.PauseCheckpoint(ctx, data)
+
 	// Send the output value, if non-empty, to the actor's outbox.
-	if len(w.Input.Output.Value) > 0 {
-		data := map[string]any{
-			"output":       w.Input.Output.Value,
-			"input_schema": w.Input.InputSchema,
-			"status":       "pause", // Mark the actor status as "pause".
-		}
+	if len(w.Input.Output.Value) > 0 && !resumed {
 		behavior.Send(data, nil)
 	}
 
@@ -0,0 +1,255 @@
+package orchestrator
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig is the configuration for caching the output of a task.
+type CacheConfig struct {
+	// Key is the cache key, which is typically an expression evaluated
+	// against the input environment (e.g. "${input.userId}"). The resulting
+	// value will be combined with the flow identity (see ContextWithCacheScope)
+	// and the task path, so different tasks never share cached outputs.
+	Key string `json:"key"`
+	// TTL is the duration for which the cached output stays valid. Zero
+	// means no expiration.
+	TTL time.Duration `json:"ttl"`
+}
+
+// Cache caches the outputs of tasks.
+type Cache interface {
+	// Get returns the cached output of the given key, if any.
+	Get(ctx context.Context, key string) (Output, bool, error)
+	// Set caches the output with the given key for the given TTL. Zero TTL
+	// means no expiration.
+	Set(ctx context.Context, key string, output Output, ttl time.Duration) error
+}
+
+type cacheKey struct{}
+
+// ContextWithCache returns a copy of ctx which carries the cache. Outputs of
+// the instrumented tasks (see Instrument) with a cache configuration will
+// then be cached. When a task's cache key hits, the task will be skipped and
+// the cached output will be used instead.
+func ContextWithCache(ctx context.Context, cache Cache) context.Context {
+	return context.WithValue(ctx, cacheKey{}, cache)
+}
+
+// CacheFromContext returns the cache carried by ctx, if any.
+func CacheFromContext(ctx context.Context) Cache {
+	cache, _ := ctx.Value(cacheKey{}).(Cache)
+	return cache
+}
+
+type cacheScopeKey struct{}
+
+// ContextWithCacheScope returns a copy of ctx which carries the identity of
+// the flow being executed (e.g. the loader and the name of the flow), which
+// will be combined into the cache keys. This prevents different flows with
+// the same task names from sharing cached outputs. The built-in Call task
+// (as well as CallFlow and TraceFlow) sets the scope automatically.
+func ContextWithCacheScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, cacheScopeKey{}, scope)
+}
+
+func cacheScopeFromContext(ctx context.Context) string {
+	scope, _ := ctx.Value(cacheScopeKey{}).(string)
+	return scope
+}
+
+// executeCached executes the task with caching, if both the cache and the
+// task's cache configuration are present.
+func (t instrumentedTask) executeCached(ctx context.Context, input Input, header TaskHeader, note *eventNote) (Output, error) {
+	cache := CacheFromContext(ctx)
+	if cache == nil || header.Cache == nil {
+		return t.Task.Execute(ctx, input)
+	}
+
+	value, err := input.Evaluate(header.Cache.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate cache key: %w", err)
+	}
+	key := fmt.Sprintf("%s:%s:%v", cacheScopeFromContext(ctx), strings.Join(TaskPathFromContext(ctx), "/"), value)
+
+	output, ok, err := cache.Get(ctx, key)
+	if err != nil {
+		Log(ctx, err, "failed to get cache")
+	}
+	if ok {
+		LoggerFromContext(ctx).DebugContext(ctx, "task cache hit", "key", key)
+		note.setCacheHit()
+		return copyOutputDeep(output), nil
+	}
+
+	output, err = t.Task.Execute(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if reusable(output) {
+		if err := cache.Set(ctx, key, copyOutputDeep(output), header.Cache.TTL); err != nil {
+			Log(ctx, err, "failed to set cache")
+		}
+	}
+	return output, nil
+}
+
+// reusable reports whether the output can be reused, which is false if it
+// carries an iterator, an actor or a reader (e.g. the body of an HTTP task in
+// the reader response mode), all of which can only be consumed once.
+func reusable(output Output) bool {
+	if _, ok := output.Iterator(); ok {
+		return false
+	}
+	if _, ok := output.Actor(); ok {
+		return false
+	}
+	for _, v := range output {
+		if _, ok := v.(io.Reader); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// copyOutputDeep makes a deep copy of the output, to prevent the cached
+// output from being modified by its users, and vice versa. Only maps and
+// slices are copied, while all the other values are shared.
+func copyOutputDeep(output Output) Output {
+	if output == nil {
+		return nil
+	}
+	out := make(Output, len(output))
+	for k, v := range output {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+func copyValue(v any) any {
+	if v == nil {
+		return nil
+	}
+	return copyReflectValue(reflect.ValueOf(v)).Interface()
+}
+
+func copyReflectValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(copyReflectValue(v.Elem()))
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), copyReflectValue(iter.Value()))
+		}
+		return out
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(copyReflectValue(v.Index(i)))
+		}
+		return out
+
+	default:
+		return v
+	}
+}
+
+// LRUCache is an in-memory cache, which evicts the least recently used
+// entry once the capacity is reached.
+type LRUCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // The front is the most recently used.
+}
+
+type lruEntry struct {
+	key      string
+	output   Output
+	expireAt time.Time // Zero means no expiration.
+}
+
+// NewLRUCache creates an LRU cache with the given capacity (i.e. the maximum
+// number of entries).
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) (Output, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if !entry.expireAt.IsZero() && time.Now().After(entry.expireAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.output, true, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, output Output, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = &lruEntry{key: key, output: output, expireAt: expireAt}
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, output: output, expireAt: expireAt})
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of entries in the cache, including the expired ones
+// that have not been evicted yet.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,129 @@
+package orchestrator_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+func TestCache(t *testing.T) {
+	var lookups int
+	lookup := builtin.NewFunc("lookup").Func(func(_ context.Context, input orchestrator.Input) (orchestrator.Output, error) {
+		lookups++
+		return orchestrator.Output{"user": input.Get("input")["id"]}, nil
+	}).Build().(*builtin.Func)
+	lookup.Cache = &orchestrator.CacheConfig{Key: "${input.id}", TTL: time.Minute}
+
+	flow := builtin.NewSerial("flow").Tasks(taskBuilder{lookup}).Build()
+
+	cache := orchestrator.NewLRUCache(1)
+	ctx := orchestrator.ContextWithCache(context.Background(), cache)
+
+	tests := []struct {
+		inID         int
+		wantLookups  int
+		wantCacheHit bool
+	}{
+		{inID: 1, wantLookups: 1, wantCacheHit: false},
+		{inID: 1, wantLookups: 1, wantCacheHit: true},
+		{inID: 2, wantLookups: 2, wantCacheHit: false},
+		// The entry of ID 1 has been evicted.
+		{inID: 1, wantLookups: 3, wantCacheHit: false},
+	}
+	for _, tt := range tests {
+		event := orchestrator.TraceTask(ctx, flow, orchestrator.NewInput(map[string]any{"id": tt.inID}))
+		if event.Error != nil {
+			t.Fatalf("Err: %v", event.Error)
+		}
+		if lookups != tt.wantLookups {
+			t.Fatalf("Lookups: Got (%d) != Want (%d)", lookups, tt.wantLookups)
+		}
+		e := event.Events[0]
+		if e.CacheHit != tt.wantCacheHit {
+			t.Fatalf("CacheHit: Got (%v) != Want (%v)", e.CacheHit, tt.wantCacheHit)
+		}
+		if event.CacheHit {
+			t.Fatalf("CacheHit of flow: Got (true) != Want (false)")
+		}
+		if got := e.Output["user"]; got != tt.inID {
+			t.Fatalf("Output: Got (%v) != Want (%v)", got, tt.inID)
+		}
+	}
+}
+
+func TestCache_Copy(t *testing.T) {
+	var lookups int
+	lookup := builtin.NewFunc("lookup").Func(func(_ context.Context, input orchestrator.Input) (orchestrator.Output, error) {
+		lookups++
+		return orchestrator.Output{"user": map[string]any{"name": "bob", "tags": []any{"a"}}}, nil
+	}).Build().(*builtin.Func)
+	lookup.Cache = &orchestrator.CacheConfig{Key: "key"}
+
+	task := orchestrator.Instrument(lookup)
+	ctx := orchestrator.ContextWithCache(context.Background(), orchestrator.NewLRUCache(1))
+
+	// Modifying the outputs never corrupts the cached one.
+	for i := 0; i < 3; i++ {
+		output, err := task.Execute(ctx, orchestrator.NewInput(nil))
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		user := output["user"].(map[string]any)
+		if user["name"] != "bob" || user["tags"].([]any)[0] != "a" {
+			t.Fatalf("Output: Got (%v) != Want (bob with tag a)", user)
+		}
+		user["name"] = "alice"
+		user["tags"].([]any)[0] = "b"
+	}
+	if lookups != 1 {
+		t.Fatalf("Lookups: Got (%d) != Want (1)", lookups)
+	}
+}
+
+func TestCache_Reader(t *testing.T) {
+	var lookups int
+	lookup := builtin.NewFunc("lookup").Func(func(_ context.Context, input orchestrator.Input) (orchestrator.Output, error) {
+		lookups++
+		return orchestrator.Output{"body": strings.NewReader("data")}, nil
+	}).Build().(*builtin.Func)
+	lookup.Cache = &orchestrator.CacheConfig{Key: "key"}
+
+	ctx := orchestrator.ContextWithCache(context.Background(), orchestrator.NewLRUCache(1))
+
+	// Readers can only be consumed once, thus are never cached.
+	for i := 0; i < 2; i++ {
+		event := orchestrator.TraceTask(ctx, lookup, orchestrator.NewInput(nil))
+		if event.Error != nil {
+			t.Fatalf("Err: %v", event.Error)
+		}
+		if event.CacheHit {
+			t.Fatalf("CacheHit: Got (true) != Want (false)")
+		}
+	}
+	if lookups != 2 {
+		t.Fatalf("Lookups: Got (%d) != Want (2)", lookups)
+	}
+}
+
+func TestLRUCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	cache := orchestrator.NewLRUCache(10)
+	_ = cache.Set(ctx, "a", orchestrator.Output{"v": 1}, 10*time.Millisecond)
+	_ = cache.Set(ctx, "b", orchestrator.Output{"v": 2}, 0)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Fatalf("a: Got (hit) != Want (miss)")
+	}
+	if _, ok, _ := cache.Get(ctx, "b"); !ok {
+		t.Fatalf("b: Got (miss) != Want (hit)")
+	}
+	if n := cache.Len(); n != 1 {
+		t.Fatalf("Len: Got (%d) != Want (1)", n)
+	}
+}
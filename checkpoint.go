@@ -0,0 +1,422 @@
+package orchestrator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+// Checkpoint is the persisted progress of an execution.
+type Checkpoint struct {
+	ExecutionID string `json:"execution_id"`
+
+	// The reference to the flow, which is used to reload the flow on resuming.
+	Loader string         `json:"loader,omitempty"`
+	Flow   string         `json:"flow,omitempty"`
+	Input  map[string]any `json:"input,omitempty"`
+
+	// Outputs hold the outputs of the completed tasks, keyed by the task paths
+	// (with iteration numbers, if any; see ContextWithIteration).
+	Outputs map[string]map[string]any `json:"outputs,omitempty"`
+}
+
+// CheckpointStore persists the checkpoints of executions.
+type CheckpointStore interface {
+	// Create creates the checkpoint of a new execution.
+	Create(ctx context.Context, cp Checkpoint) error
+	// SaveOutput records the output of a completed task of the given execution.
+	SaveOutput(ctx context.Context, executionID, key string, output map[string]any) error
+	// Get returns the checkpoint of the given execution.
+	Get(ctx context.Context, executionID string) (Checkpoint, error)
+	// Delete deletes the checkpoint of the given execution.
+	Delete(ctx context.Context, executionID string) error
+}
+
+type checkpointStoreKey struct{}
+
+// ContextWithCheckpointStore returns a copy of ctx which carries the checkpoint store.
+func ContextWithCheckpointStore(ctx context.Context, store CheckpointStore) context.Context {
+	return context.WithValue(ctx, checkpointStoreKey{}, store)
+}
+
+// CheckpointStoreFromContext returns the checkpoint store carried by ctx, if any.
+func CheckpointStoreFromContext(ctx context.Context) CheckpointStore {
+	store, _ := ctx.Value(checkpointStoreKey{}).(CheckpointStore)
+	return store
+}
+
+type checkpointKey struct{}
+
+// ContextWithCheckpoint returns a copy of ctx which enables checkpointing for
+// the execution of the given checkpoint, whose ID will also be used as the
+// execution ID. ctx must carry a checkpoint store (see ContextWithCheckpointStore).
+//
+// Every instrumented task (see Instrument) will save its output into the store
+// once completed. When resuming an execution, each leaf task whose output has
+// been recorded in the checkpoint will be skipped, and the recorded output will
+// be used instead. Composite tasks are always re-executed, so as to rebuild the
+// input environment.
+func ContextWithCheckpoint(ctx context.Context, cp Checkpoint) context.Context {
+	store := CheckpointStoreFromContext(ctx)
+	if store == nil {
+		return ctx
+	}
+	c := &checkpointer{
+		store:      store,
+		id:         cp.ExecutionID,
+		outputs:    cp.Outputs,
+		composites: make(map[string]bool),
+	}
+	// Index the composite tasks once, so that each lookup on resuming
+	// takes constant time.
+	for k := range cp.Outputs {
+		for i := 0; i < len(k); i++ {
+			if k[i] == '/' {
+				c.composites[k[:i]] = true
+			}
+		}
+	}
+	return context.WithValue(ContextWithExecutionID(ctx, cp.ExecutionID), checkpointKey{}, c)
+}
+
+type checkpointer struct {
+	store   CheckpointStore
+	id      string
+	outputs map[string]map[string]any
+	// The keys of the composite tasks, whose descendants have been recorded.
+	composites map[string]bool
+}
+
+// restore returns the recorded output of the task with the given key, if the
+// task is a completed leaf task.
+func (c *checkpointer) restore(key string) (Output, bool) {
+	output, ok := c.outputs[key]
+	if !ok || c.composites[key] {
+		return nil, false
+	}
+	return output, true
+}
+
+// save saves the output of the task with the given key. Outputs which can
+// not be reused (see reusable), and thus can not be persisted, are ignored.
+func (c *checkpointer) save(ctx context.Context, key string, output Output) {
+	if !reusable(output) {
+		return
+	}
+	if err := c.store.SaveOutput(ctx, c.id, key, output); err != nil {
+		Log(ctx, err, "failed to save checkpoint")
+	}
+}
+
+// pauseKeySuffix is appended to the key of a paused task, to record the data
+// that the task sent to the outside world before pausing.
+const pauseKeySuffix = "@paused"
+
+// Paused returns the key of the task at which the execution is paused (see
+// PauseCheckpoint), along with the data that the task sent before pausing.
+func (cp Checkpoint) Paused() (key string, data map[string]any, ok bool) {
+	for k, v := range cp.Outputs {
+		key := strings.TrimSuffix(k, pauseKeySuffix)
+		if key == k {
+			continue
+		}
+		if _, completed := cp.Outputs[key]; !completed {
+			return key, v, true
+		}
+	}
+	return "", nil, false
+}
+
+// PauseCheckpoint records that the current task (e.g. a Wait task) is about
+// to pause for receiving external input, along with the data it sends to the
+// outside world before pausing. It does nothing if checkpointing is disabled.
+//
+// PauseCheckpoint reports whether the task had already been paused before,
+// i.e. the execution is being resumed at the task, in which case the data
+// should not be sent again.
+func PauseCheckpoint(ctx context.Context, data map[string]any) (resumed bool) {
+	c := checkpointerFromContext(ctx)
+	if c == nil {
+		return false
+	}
+
+	key := taskKeyFromContext(ctx) + pauseKeySuffix
+	if _, ok := c.outputs[key]; ok {
+		return true
+	}
+	if data == nil {
+		data = map[string]any{}
+	}
+	if err := c.store.SaveOutput(ctx, c.id, key, data); err != nil {
+		Log(ctx, err, "failed to save checkpoint")
+	}
+	return false
+}
+
+// CompleteCheckpoint deletes the checkpoint of the current execution, which
+// has completed and thus will never be resumed. It does nothing if
+// checkpointing is disabled.
+func CompleteCheckpoint(ctx context.Context) {
+	c := checkpointerFromContext(ctx)
+	if c == nil {
+		return
+	}
+	if err := c.store.Delete(ctx, c.id); err != nil {
+		Log(ctx, err, "failed to delete checkpoint")
+	}
+}
+
+// checkpointerFromContext returns the checkpointer carried by ctx, if any.
+func checkpointerFromContext(ctx context.Context) *checkpointer {
+	c, _ := ctx.Value(checkpointKey{}).(*checkpointer)
+	return c
+}
+
+// copyOutput makes a deep copy of the output through JSON, just like how it
+// will be persisted. Numbers are restored as int if possible (see
+// restoreNumbers), so that a resumed execution sees the same values as the
+// original one.
+func copyOutput(output map[string]any) (map[string]any, error) {
+	data, err := json.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var out map[string]any
+	if err := d.Decode(&out); err != nil {
+		return nil, err
+	}
+	return restoreNumbers(out).(map[string]any), nil
+}
+
+// restoreNumbers converts all the JSON numbers within v into int, or float64
+// if they are not integers.
+func restoreNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 0); err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, vv := range v {
+			v[k] = restoreNumbers(vv)
+		}
+		return v
+	case []any:
+		for i, vv := range v {
+			v[i] = restoreNumbers(vv)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// MemoryCheckpointStore is an in-memory checkpoint store.
+type MemoryCheckpointStore struct {
+	mu          sync.RWMutex
+	checkpoints map[string]*Checkpoint
+}
+
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{
+		checkpoints: make(map[string]*Checkpoint),
+	}
+}
+
+func (s *MemoryCheckpointStore) Create(ctx context.Context, cp Checkpoint) error {
+	if cp.Input != nil {
+		input, err := copyOutput(cp.Input)
+		if err != nil {
+			return err
+		}
+		cp.Input = input
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.checkpoints[cp.ExecutionID]; ok {
+		return fmt.Errorf("checkpoint of execution %q already exists", cp.ExecutionID)
+	}
+
+	outputs := make(map[string]map[string]any, len(cp.Outputs))
+	for k, v := range cp.Outputs {
+		outputs[k] = v
+	}
+	cp.Outputs = outputs
+	s.checkpoints[cp.ExecutionID] = &cp
+	return nil
+}
+
+func (s *MemoryCheckpointStore) SaveOutput(ctx context.Context, executionID, key string, output map[string]any) error {
+	out, err := copyOutput(output)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp, ok := s.checkpoints[executionID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCheckpointNotFound, executionID)
+	}
+	cp.Outputs[key] = out
+	return nil
+}
+
+func (s *MemoryCheckpointStore) Get(ctx context.Context, executionID string) (Checkpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cp, ok := s.checkpoints[executionID]
+	if !ok {
+		return Checkpoint{}, fmt.Errorf("%w: %s", ErrCheckpointNotFound, executionID)
+	}
+
+	out := *cp
+	out.Outputs = make(map[string]map[string]any, len(cp.Outputs))
+	for k, v := range cp.Outputs {
+		out.Outputs[k] = v
+	}
+	return out, nil
+}
+
+func (s *MemoryCheckpointStore) Delete(ctx context.Context, executionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.checkpoints[executionID]; !ok {
+		return fmt.Errorf("%w: %s", ErrCheckpointNotFound, executionID)
+	}
+	delete(s.checkpoints, executionID)
+	return nil
+}
+
+// checkpointOp is a line in the file of FileCheckpointStore.
+type checkpointOp struct {
+	Op          string         `json:"op"` // "create", "output" or "delete"
+	ExecutionID string         `json:"execution_id"`
+	Checkpoint  *Checkpoint    `json:"checkpoint,omitempty"`
+	Key         string         `json:"key,omitempty"`
+	Output      map[string]any `json:"output,omitempty"`
+}
+
+// FileCheckpointStore is a checkpoint store backed by a JSONL file, in which
+// each line is an operation (i.e. create, output or delete) appended in order.
+// All checkpoints are also indexed in memory.
+//
+// Unlike traces, the outputs are persisted without redaction (see
+// RedactValue), since a resumed execution must see exactly the same outputs
+// as the original one (e.g. a token fetched by a completed task and used by
+// the remaining ones). Therefore the file is only accessible to its owner,
+// and should be protected like any other store of secrets.
+type FileCheckpointStore struct {
+	*MemoryCheckpointStore
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileCheckpointStore opens (or creates) the file at the given path, and
+// replays all the existing operations from it.
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileCheckpointStore{
+		MemoryCheckpointStore: NewMemoryCheckpointStore(),
+		file:                  file,
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var op checkpointOp
+		if err := json.Unmarshal(line, &op); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to load checkpoint: %v", err)
+		}
+		if err := s.apply(op); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileCheckpointStore) Create(ctx context.Context, cp Checkpoint) error {
+	return s.write(checkpointOp{Op: "create", ExecutionID: cp.ExecutionID, Checkpoint: &cp})
+}
+
+func (s *FileCheckpointStore) SaveOutput(ctx context.Context, executionID, key string, output map[string]any) error {
+	return s.write(checkpointOp{Op: "output", ExecutionID: executionID, Key: key, Output: output})
+}
+
+func (s *FileCheckpointStore) Delete(ctx context.Context, executionID string) error {
+	return s.write(checkpointOp{Op: "delete", ExecutionID: executionID})
+}
+
+// Close closes the underlying file.
+func (s *FileCheckpointStore) Close() error {
+	return s.file.Close()
+}
+
+// write applies the operation to the memory index, and then appends it to
+// the file if succeeded.
+func (s *FileCheckpointStore) write(op checkpointOp) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.apply(op); err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileCheckpointStore) apply(op checkpointOp) error {
+	ctx := context.Background()
+	switch op.Op {
+	case "create":
+		if op.Checkpoint == nil {
+			return fmt.Errorf("bad checkpoint operation: no checkpoint")
+		}
+		return s.MemoryCheckpointStore.Create(ctx, *op.Checkpoint)
+	case "output":
+		return s.MemoryCheckpointStore.SaveOutput(ctx, op.ExecutionID, op.Key, op.Output)
+	case "delete":
+		return s.MemoryCheckpointStore.Delete(ctx, op.ExecutionID)
+	default:
+		return fmt.Errorf("bad checkpoint operation %q", op.Op)
+	}
+}
@@ -164,6 +164,7 @@ func (e *Evaluator) evaluateJSONPathVar(s string) (any, error) {
 func (e *Evaluator) evaluateExprVar(s string) (any, error) {
 	env := map[string]any{
 		"getenv": os.Getenv,
+		"secret": ResolveSecret,
 	}
 	for k, v := range e.data {
 		env[k] = v
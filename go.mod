@@ -1,6 +1,6 @@
 module github.com/RussellLuo/orchestrator
 
-go 1.20
+go 1.21
 
 require (
 	github.com/PaesslerAG/jsonpath v0.1.1
@@ -0,0 +1,118 @@
+package orchestrator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// HTTPClientFactory creates HTTP clients for the HTTP-based tasks.
+//
+// A factory is called once for each task, which will make a shallow copy of
+// the client before applying its own settings (e.g. the timeout). To share
+// the connection pool, return clients with the same transport.
+type HTTPClientFactory func() (*http.Client, error)
+
+// SetHTTPClientFactory sets the HTTP client factory of the connection profile
+// with the given name, which can be referenced by the HTTP-based tasks (e.g.
+// `client: internal-mtls`). The empty name stands for the default profile,
+// which is used by tasks that specify no profile.
+func (r *Registry) SetHTTPClientFactory(name string, factory HTTPClientFactory) {
+	if r.httpClients == nil {
+		r.httpClients = make(map[string]HTTPClientFactory)
+	}
+	r.httpClients[name] = factory
+}
+
+// HTTPClient creates an HTTP client from the connection profile with the
+// given name. If the default profile has not been set, a zero http.Client
+// (which uses http.DefaultTransport) will be returned.
+func (r *Registry) HTTPClient(name string) (*http.Client, error) {
+	factory, ok := r.httpClients[name]
+	if !ok {
+		if name != "" {
+			return nil, fmt.Errorf("http client profile %q is not found", name)
+		}
+		return &http.Client{}, nil
+	}
+	return factory()
+}
+
+// HTTPClientConfig is a common configuration of HTTP clients.
+type HTTPClientConfig struct {
+	// The files of the PEM-encoded root certificates, which replace the
+	// system ones if specified.
+	RootCAFiles []string
+	// The files of the PEM-encoded client certificate and its private key,
+	// which are used for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables the verification of server certificates.
+	InsecureSkipVerify bool
+
+	// ProxyURL is the URL of the proxy server. If empty, the proxy will be
+	// determined by the environment variables (e.g. HTTPS_PROXY).
+	ProxyURL string
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// Timeout is the default timeout, which can be overridden by tasks.
+	Timeout time.Duration
+}
+
+// NewHTTPClientFactory creates an HTTP client factory from the configuration.
+// All the clients created by the factory share the same transport.
+func NewHTTPClientFactory(config HTTPClientConfig) (HTTPClientFactory, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify} // #nosec G402
+	if len(config.RootCAFiles) > 0 {
+		pool := x509.NewCertPool()
+		for _, file := range config.RootCAFiles {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no certificates found in %s", file)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if config.ProxyURL != "" {
+		u, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("bad proxy URL: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+
+	return func() (*http.Client, error) {
+		return &http.Client{Transport: transport, Timeout: config.Timeout}, nil
+	}, nil
+}
@@ -0,0 +1,62 @@
+package orchestrator_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+func TestNewHTTPClientFactory(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// Trust the certificate of the test server.
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, data, 0o600); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	factory, err := orchestrator.NewHTTPClientFactory(orchestrator.HTTPClientConfig{
+		RootCAFiles: []string{caFile},
+	})
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	r := orchestrator.NewRegistry()
+	r.SetHTTPClientFactory("internal", factory)
+
+	client, err := r.HTTPClient("internal")
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Status: Got (%d) != Want (%d)", resp.StatusCode, http.StatusNoContent)
+	}
+
+	// Clients of the same factory share the transport.
+	other, _ := r.HTTPClient("internal")
+	if other.Transport != client.Transport {
+		t.Fatal("Transport: not shared")
+	}
+
+	if _, err := r.HTTPClient("unknown"); err == nil {
+		t.Fatal("Err: Got (nil) != Want (profile not found)")
+	}
+	if _, err := orchestrator.NewHTTPClientFactory(orchestrator.HTTPClientConfig{RootCAFiles: []string{filepath.Join(t.TempDir(), "missing.pem")}}); err == nil {
+		t.Fatal("Err: Got (nil) != Want (file not found)")
+	}
+}
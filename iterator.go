@@ -23,7 +23,12 @@ func NewIterator(ctx context.Context, f func(sender *IteratorSender)) *Iterator
 	breakCh := make(chan struct{}, 1)
 
 	sender := &IteratorSender{ctx: ctx, ch: ch, breakCh: breakCh}
-	go f(sender)
+	metrics := MetricsFromContext(ctx)
+	metrics.IteratorOpened()
+	go func() {
+		defer metrics.IteratorClosed()
+		f(sender)
+	}()
 
 	return &Iterator{
 		ch:      ch,
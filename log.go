@@ -0,0 +1,158 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+type loggerKey struct{}
+
+type logger struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// ContextWithLogger returns a copy of ctx which carries the logger. Lifecycle
+// events of tasks (e.g. HTTP requests) will be logged at the given level,
+// while failures will always be logged at slog.LevelError.
+func ContextWithLogger(ctx context.Context, l *slog.Logger, level slog.Level) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger{logger: l, level: level})
+}
+
+// LoggerFromContext returns the logger carried by ctx, which has been
+// populated with the flow name, the task path, the task type and the
+// execution ID of the current task. If there is no logger, a logger that
+// discards all records will be returned.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	l, ok := ctx.Value(loggerKey{}).(logger)
+	if !ok {
+		return discardLogger
+	}
+
+	var args []any
+	if path := TaskPathFromContext(ctx); len(path) > 0 {
+		info, _ := ctx.Value(taskInfoKey{}).(taskInfo)
+		args = append(args,
+			slog.String("flow", path[0]),
+			slog.String("task_path", strings.Join(path, "/")),
+			slog.String("task_type", info.typ),
+		)
+	}
+	if id := ExecutionIDFromContext(ctx); id != "" {
+		args = append(args, slog.String("execution_id", id))
+	}
+	return l.logger.With(args...)
+}
+
+// Log logs a lifecycle event of the current task. If err is nil, the event
+// is logged at the level specified in ContextWithLogger, otherwise it is
+// logged at slog.LevelError along with the error.
+func Log(ctx context.Context, err error, msg string, args ...any) {
+	l, ok := ctx.Value(loggerKey{}).(logger)
+	if !ok {
+		return
+	}
+
+	// Never leak secrets through logs. Copy the arguments to leave the
+	// caller's slice intact.
+	args = append(make([]any, 0, len(args)+1), args...)
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			args[i] = Redact(s)
+		}
+	}
+
+	level := l.level
+	if err != nil {
+		level = slog.LevelError
+		args = append(args, slog.String("error", Redact(err.Error())))
+	}
+	LoggerFromContext(ctx).Log(ctx, level, msg, args...)
+}
+
+type taskInfoKey struct{}
+
+type taskInfo struct {
+	path []string
+	typ  string
+	// key is like path, but with iteration numbers if any (see ContextWithIteration).
+	key []string
+}
+
+// contextWithTask returns a copy of ctx which records that the execution
+// has entered the task with the given header.
+func contextWithTask(ctx context.Context, header TaskHeader) context.Context {
+	parent, _ := ctx.Value(taskInfoKey{}).(taskInfo)
+
+	// Always make a new slice to avoid sharing the underlying array between
+	// sibling tasks (e.g. subtasks of a Parallel task).
+	path := make([]string, len(parent.path), len(parent.path)+1)
+	copy(path, parent.path)
+	path = append(path, header.Name)
+
+	key := make([]string, len(parent.key), len(parent.key)+1)
+	copy(key, parent.key)
+	key = append(key, header.Name)
+
+	return context.WithValue(ctx, taskInfoKey{}, taskInfo{path: path, typ: header.Type, key: key})
+}
+
+// ContextWithIteration returns a copy of ctx which records that the execution
+// has entered the i-th (zero-based) iteration of the current task (e.g. a Loop
+// task). This distinguishes the checkpoints of the same subtask in different
+// iterations.
+func ContextWithIteration(ctx context.Context, i int) context.Context {
+	info, _ := ctx.Value(taskInfoKey{}).(taskInfo)
+	if len(info.key) == 0 {
+		return ctx
+	}
+
+	key := make([]string, len(info.key))
+	copy(key, info.key)
+	key[len(key)-1] += "#" + strconv.Itoa(i)
+	info.key = key
+
+	return context.WithValue(ctx, taskInfoKey{}, info)
+}
+
+// taskKeyFromContext returns the unique key of the current task within the
+// execution.
+func taskKeyFromContext(ctx context.Context) string {
+	info, _ := ctx.Value(taskInfoKey{}).(taskInfo)
+	return strings.Join(info.key, "/")
+}
+
+// TaskPathFromContext returns the path of the current task, which consists
+// of the names of all the instrumented tasks (see Instrument) from the
+// outermost one to the current one.
+func TaskPathFromContext(ctx context.Context) []string {
+	info, _ := ctx.Value(taskInfoKey{}).(taskInfo)
+	return info.path
+}
+
+type executionIDKey struct{}
+
+// NewExecutionID returns a new random execution ID.
+func NewExecutionID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ContextWithExecutionID returns a copy of ctx which carries the execution ID.
+func ContextWithExecutionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, executionIDKey{}, id)
+}
+
+// ExecutionIDFromContext returns the execution ID carried by ctx, if any.
+func ExecutionIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(executionIDKey{}).(string)
+	return id
+}
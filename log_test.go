@@ -0,0 +1,141 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoggerFromContext(t *testing.T) {
+	flow := builtin.NewSerial("flow").Tasks(
+		builtin.NewDecision("choose").Expression("${input.value}").
+			Case(1, builtin.NewFunc("one").Func(func(ctx context.Context, input orchestrator.Input) (orchestrator.Output, error) {
+				orchestrator.LoggerFromContext(ctx).Info("hello")
+				return orchestrator.Output{}, nil
+			})),
+	).Build()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "elapsed" {
+				// Remove the time for the stability of the test.
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	ctx := orchestrator.ContextWithLogger(context.Background(), logger, slog.LevelInfo)
+	ctx = orchestrator.ContextWithExecutionID(ctx, "1")
+	input := orchestrator.NewInput(map[string]any{"value": 1})
+	if _, err := orchestrator.Instrument(flow).Execute(ctx, input); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	var got []map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var m map[string]any
+		if err := dec.Decode(&m); err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		got = append(got, m)
+	}
+
+	want := []map[string]any{
+		{
+			"level":        "INFO",
+			"msg":          "decision made",
+			"flow":         "flow",
+			"task_path":    "flow/choose",
+			"task_type":    "decision",
+			"execution_id": "1",
+			"value":        float64(1),
+			"branch":       "case",
+			"task":         "one",
+		},
+		{
+			"level":        "INFO",
+			"msg":          "hello",
+			"flow":         "flow",
+			"task_path":    "flow/choose/one",
+			"task_type":    "func",
+			"execution_id": "1",
+		},
+		{
+			"level":        "INFO",
+			"msg":          "task finished",
+			"flow":         "flow",
+			"task_path":    "flow/choose/one",
+			"task_type":    "func",
+			"execution_id": "1",
+		},
+		{
+			"level":        "INFO",
+			"msg":          "task finished",
+			"flow":         "flow",
+			"task_path":    "flow/choose",
+			"task_type":    "decision",
+			"execution_id": "1",
+		},
+		{
+			"level":        "INFO",
+			"msg":          "task finished",
+			"flow":         "flow",
+			"task_path":    "flow",
+			"task_type":    "serial",
+			"execution_id": "1",
+		},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("Want - Got: %s", cmp.Diff(want, got))
+	}
+
+	// Failures are always logged at the error level.
+	buf.Reset()
+	failing := builtin.NewFunc("fail").Func(func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+		return nil, errors.New("oops")
+	}).Build()
+	if _, err := orchestrator.Instrument(failing).Execute(ctx, input); err == nil {
+		t.Fatalf("Err: Got (nil) != Want (oops)")
+	}
+	var m map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if m["level"] != "ERROR" || m["msg"] != "task failed" || m["error"] != "oops" {
+		t.Errorf("Record: Got (%v)", m)
+	}
+}
+
+func TestLog(t *testing.T) {
+	defer func(p orchestrator.SecretProvider) { orchestrator.DefaultSecretProvider = p }(orchestrator.DefaultSecretProvider)
+	orchestrator.DefaultSecretProvider = orchestrator.MapSecretProvider{"token": "t0ken-1234567890"}
+	if _, err := orchestrator.ResolveSecret("token"); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	ctx := orchestrator.ContextWithLogger(context.Background(), logger, slog.LevelInfo)
+
+	args := []any{"token", "t0ken-1234567890"}
+	orchestrator.Log(ctx, nil, "request", args...)
+
+	if got := buf.String(); !strings.Contains(got, "token=******") {
+		t.Fatalf("Record: Got (%s) != Want (containing token=******)", got)
+	}
+	// The caller's arguments are left intact.
+	if args[1] != "t0ken-1234567890" {
+		t.Fatalf("Args: Got (%v) != Want (t0ken-1234567890)", args[1])
+	}
+}
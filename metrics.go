@@ -0,0 +1,124 @@
+package orchestrator
+
+import (
+	"context"
+	"time"
+)
+
+// Metrics collects measurements of the execution engine.
+type Metrics interface {
+	// TaskStarted is called right before a task starts executing.
+	TaskStarted(header TaskHeader)
+
+	// TaskFinished is called right after a task finishes executing, with
+	// the elapsed time and the resulting error, if any.
+	TaskFinished(header TaskHeader, elapsed time.Duration, err error)
+
+	// ActorStarted is called when an actor starts running.
+	ActorStarted()
+
+	// ActorStopped is called when an actor stops running.
+	ActorStopped()
+
+	// IteratorOpened is called when an iterator starts producing values.
+	IteratorOpened()
+
+	// IteratorClosed is called when an iterator stops producing values.
+	IteratorClosed()
+}
+
+type metricsKey struct{}
+
+// ContextWithMetrics returns a copy of ctx which carries the metrics m.
+func ContextWithMetrics(ctx context.Context, m Metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, m)
+}
+
+// MetricsFromContext returns the metrics carried by ctx. If there is no
+// metrics, a no-op implementation will be returned.
+func MetricsFromContext(ctx context.Context) Metrics {
+	if m, ok := ctx.Value(metricsKey{}).(Metrics); ok {
+		return m
+	}
+	return nopMetrics{}
+}
+
+// Instrument wraps a task to return a new task, which will automatically
+// report its executions to the metrics carried by the context. It also
+// records the task into the execution context, which makes the task path
+// available (see TaskPathFromContext and LoggerFromContext), stubs the task
+// during a replay (see Replay), saves or restores the task's output if
+// checkpointing is enabled (see ContextWithCheckpoint), and caches the task's
+// output if configured (see ContextWithCache).
+//
+// All subtasks of the built-in composite tasks, as well as the tasks executed
+// by TraceTask, are instrumented already. Typically, you only need to
+// instrument the top-level task (i.e. the flow) yourself when executing it
+// directly. Instrumenting a task more than once has no effect.
+func Instrument(task Task) Task {
+	if _, ok := task.(instrumentedTask); ok {
+		return task
+	}
+	return instrumentedTask{Task: task}
+}
+
+type instrumentedTask struct {
+	Task
+}
+
+func (t instrumentedTask) Execute(ctx context.Context, input Input) (Output, error) {
+	metrics := MetricsFromContext(ctx)
+	header := t.Task.Header()
+	ctx = contextWithTask(ctx, header)
+	// The note is only for the current task, not for its subtasks.
+	note := eventNoteFromContext(ctx)
+	ctx = contextWithEventNote(ctx, nil)
+
+	metrics.TaskStarted(header)
+	start := time.Now()
+	output, err := t.execute(ctx, input, header, note)
+	// Never leak secrets through error messages.
+	err = RedactError(err)
+	elapsed := time.Since(start)
+	metrics.TaskFinished(header, elapsed, err)
+
+	if err != nil {
+		Log(ctx, err, "task failed", "elapsed", elapsed)
+	} else {
+		Log(ctx, nil, "task finished", "elapsed", elapsed)
+	}
+	return output, err
+}
+
+func (t instrumentedTask) execute(ctx context.Context, input Input, header TaskHeader, note *eventNote) (Output, error) {
+	if r := replayFromContext(ctx); r != nil {
+		if output, ok, err := r.stub(ctx, header); ok {
+			return output, err
+		}
+	}
+
+	c := checkpointerFromContext(ctx)
+	if c == nil {
+		return t.executeCached(ctx, input, header, note)
+	}
+
+	key := taskKeyFromContext(ctx)
+	if output, ok := c.restore(key); ok {
+		LoggerFromContext(ctx).DebugContext(ctx, "task restored from checkpoint")
+		return output, nil
+	}
+	output, err := t.executeCached(ctx, input, header, note)
+	if err == nil {
+		c.save(ctx, key, output)
+	}
+	return output, err
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) TaskStarted(TaskHeader)                        {}
+func (nopMetrics) TaskFinished(TaskHeader, time.Duration, error) {}
+func (nopMetrics) ActorStarted()                                 {}
+func (nopMetrics) ActorStopped()                                 {}
+func (nopMetrics) IteratorOpened()                               {}
+func (nopMetrics) IteratorClosed()                               {}
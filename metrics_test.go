@@ -0,0 +1,47 @@
+package orchestrator_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+type countingMetrics struct {
+	orchestrator.Metrics
+	started map[string]int
+}
+
+func (m *countingMetrics) TaskStarted(header orchestrator.TaskHeader) {
+	m.started[header.Name]++
+}
+
+func (m *countingMetrics) TaskFinished(orchestrator.TaskHeader, time.Duration, error) {}
+
+func TestInstrument(t *testing.T) {
+	var path string
+	flow := builtin.NewSerial("flow").Tasks(
+		builtin.NewFunc("get").Func(func(ctx context.Context, _ orchestrator.Input) (orchestrator.Output, error) {
+			path = strings.Join(orchestrator.TaskPathFromContext(ctx), "/")
+			return orchestrator.Output{}, nil
+		}),
+	).Build()
+
+	metrics := &countingMetrics{started: make(map[string]int)}
+	ctx := orchestrator.ContextWithMetrics(context.Background(), metrics)
+
+	// TraceTask instruments the task, which has been instrumented already.
+	event := orchestrator.TraceTask(ctx, orchestrator.Instrument(orchestrator.Instrument(flow)), orchestrator.NewInput(nil))
+	if event.Error != nil {
+		t.Fatalf("Err: %v", event.Error)
+	}
+	if path != "flow/get" {
+		t.Fatalf("Path: Got (%q) != Want (%q)", path, "flow/get")
+	}
+	if n := metrics.started["flow"]; n != 1 {
+		t.Fatalf("Started: Got (%d) != Want (1)", n)
+	}
+}
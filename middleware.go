@@ -0,0 +1,116 @@
+package orchestrator
+
+import (
+	"context"
+	"reflect"
+)
+
+// Middleware wraps a task to return a new task, typically to add extra
+// behavior (e.g. logging or authorization) around the original task.
+//
+// The original task is available as next, whose Header method gives access
+// to the task header.
+type Middleware func(next Task) Task
+
+// Use adds the given middlewares to the registry.
+//
+// Middlewares are applied to every task constructed by the registry,
+// including all the nested tasks. They are applied in the order they are
+// added, which means that the first middleware is the outermost one.
+func (r *Registry) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Wrap applies the middlewares of the registry to the given task, as well as
+// to all its subtasks recursively.
+//
+// Wrap is intended for tasks (typically flows) made by builders. Do not use
+// it for tasks constructed by the registry, to which the middlewares have
+// already been applied.
+func (r *Registry) Wrap(task Task) Task {
+	if len(r.middlewares) == 0 {
+		return task
+	}
+	return WrapAll(task, r.applyMiddlewares)
+}
+
+func (r *Registry) applyMiddlewares(task Task) Task {
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		task = r.middlewares[i](task)
+	}
+	return task
+}
+
+// WrapAll applies the middleware m to all the subtasks of the given task
+// recursively, and then to the task itself.
+//
+// Subtasks are discovered from the exported fields, of type Task, []Task
+// or map[K]Task, of the task (and of its nested structs, such as Input).
+// Note that subtasks are replaced in place.
+func WrapAll(task Task, m Middleware) Task {
+	wrapSubtasks(reflect.ValueOf(task), m)
+	return m(task)
+}
+
+var typeTask = reflect.TypeOf((*Task)(nil)).Elem()
+
+func wrapSubtasks(v reflect.Value, m Middleware) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		switch {
+		case field.Type() == typeTask:
+			if task, ok := field.Interface().(Task); ok && task != nil {
+				field.Set(reflect.ValueOf(WrapAll(task, m)))
+			}
+
+		case field.Kind() == reflect.Slice && field.Type().Elem() == typeTask:
+			for j := 0; j < field.Len(); j++ {
+				if task, ok := field.Index(j).Interface().(Task); ok && task != nil {
+					field.Index(j).Set(reflect.ValueOf(WrapAll(task, m)))
+				}
+			}
+
+		case field.Kind() == reflect.Map && field.Type().Elem() == typeTask:
+			for _, key := range field.MapKeys() {
+				if task, ok := field.MapIndex(key).Interface().(Task); ok && task != nil {
+					field.SetMapIndex(key, reflect.ValueOf(WrapAll(task, m)))
+				}
+			}
+
+		case field.Kind() == reflect.Struct:
+			// Nested structs, such as the Input field.
+			wrapSubtasks(field, m)
+		}
+	}
+}
+
+// Decorate returns a new task, which has the same header and string
+// representation as the given task, but executes by calling f instead.
+//
+// Decorate is a helper for writing middlewares.
+func Decorate(task Task, f func(ctx context.Context, input Input) (Output, error)) Task {
+	return decoratedTask{Task: task, execute: f}
+}
+
+type decoratedTask struct {
+	Task
+	execute func(ctx context.Context, input Input) (Output, error)
+}
+
+func (t decoratedTask) Execute(ctx context.Context, input Input) (Output, error) {
+	return t.execute(ctx, input)
+}
@@ -0,0 +1,103 @@
+package orchestrator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+	"github.com/google/go-cmp/cmp"
+)
+
+// record returns a middleware which records the name of every executed task.
+func record(tag string, calls *[]string) orchestrator.Middleware {
+	return func(next orchestrator.Task) orchestrator.Task {
+		return orchestrator.Decorate(next, func(ctx context.Context, input orchestrator.Input) (orchestrator.Output, error) {
+			*calls = append(*calls, tag+":"+next.Header().Name)
+			return next.Execute(ctx, input)
+		})
+	}
+}
+
+func TestRegistry_Use(t *testing.T) {
+	noop := func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+		return orchestrator.Output{}, nil
+	}
+
+	var calls []string
+	r := orchestrator.NewRegistry()
+	builtin.MustRegisterSerial(r)
+	builtin.MustRegisterDecision(r)
+	builtin.MustRegisterFunc(r)
+	r.Use(record("a", &calls), record("b", &calls))
+
+	flow, err := r.Construct(map[string]any{
+		"name": "flow",
+		"type": builtin.TypeSerial,
+		"input": map[string]any{
+			"tasks": []map[string]any{
+				{
+					"name":  "one",
+					"type":  builtin.TypeFunc,
+					"input": map[string]any{"func": noop},
+				},
+				{
+					"name": "choose",
+					"type": builtin.TypeDecision,
+					"input": map[string]any{
+						"expression": 0,
+						"cases": map[int]map[string]any{
+							0: {
+								"name":  "two",
+								"type":  builtin.TypeFunc,
+								"input": map[string]any{"func": noop},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	if _, err := flow.Execute(context.Background(), orchestrator.NewInput(nil)); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	want := []string{
+		"a:flow", "b:flow",
+		"a:one", "b:one",
+		"a:choose", "b:choose",
+		"a:two", "b:two",
+	}
+	if !cmp.Equal(calls, want) {
+		t.Errorf("Want - Got: %s", cmp.Diff(want, calls))
+	}
+}
+
+func TestRegistry_Wrap(t *testing.T) {
+	var calls []string
+	r := orchestrator.NewRegistry()
+	r.Use(record("a", &calls))
+
+	noop := func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+		return orchestrator.Output{}, nil
+	}
+	flow := r.Wrap(builtin.NewSerial("flow").Tasks(
+		builtin.NewFunc("one").Func(noop),
+		builtin.NewParallel("both").Tasks(
+			builtin.NewFunc("two").Func(noop),
+		),
+	).Build())
+
+	if _, err := flow.Execute(context.Background(), orchestrator.NewInput(nil)); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	want := []string{"a:flow", "a:one", "a:both", "a:two"}
+	if !cmp.Equal(calls, want) {
+		t.Errorf("Want - Got: %s", cmp.Diff(want, calls))
+	}
+}
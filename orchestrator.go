@@ -83,6 +83,10 @@ type TaskHeader struct {
 	Description string `json:"description"`
 	//Schema        Schema        `json:"schema"`
 	Timeout time.Duration `json:"timeout"`
+	// DisableTrace opts the task, along with its sub-tasks, out of tracing.
+	DisableTrace bool `json:"disable_trace"`
+	// Cache enables caching the task's output, if configured.
+	Cache *CacheConfig `json:"cache"`
 }
 
 func (h TaskHeader) Header() TaskHeader { return h }
@@ -114,8 +118,10 @@ type TaskFactory struct {
 }
 
 type Registry struct {
-	factories map[string]*TaskFactory
-	decoder   *structool.Codec
+	factories   map[string]*TaskFactory
+	decoder     *structool.Codec
+	middlewares []Middleware
+	httpClients map[string]HTTPClientFactory
 }
 
 func NewRegistry() *Registry {
@@ -164,7 +170,10 @@ func (r *Registry) Construct(m map[string]any) (Task, error) {
 			return nil, err
 		}
 	}
-	return task, nil
+
+	// Note that subtasks, if any, have already been wrapped while decoding
+	// (see decodeDefinitionToTask).
+	return r.applyMiddlewares(task), nil
 }
 
 func (r *Registry) ConstructFromYAML(data []byte) (Task, error) {
@@ -0,0 +1,221 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the default upper bounds (in seconds) of the buckets
+// in the task latency histogram.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a built-in Metrics implementation, which also serves
+// as an http.Handler to expose the collected metrics in the Prometheus text
+// exposition format.
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	tasks     map[taskKey]*taskMetrics
+	actors    int64
+	iterators int64
+}
+
+type taskKey struct {
+	Type string
+	Name string
+}
+
+type taskMetrics struct {
+	executions int64
+	errors     int64
+	timeouts   int64
+	inflight   int64
+
+	// Non-cumulative bucket counts, with the last one for +Inf.
+	counts []int64
+	sum    float64
+}
+
+// NewPrometheusMetrics creates a Prometheus collector. If no buckets are
+// specified, DefaultBuckets will be used.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusMetrics{
+		buckets: buckets,
+		tasks:   make(map[taskKey]*taskMetrics),
+	}
+}
+
+func (m *PrometheusMetrics) TaskStarted(header TaskHeader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tm := m.getTask(header)
+	tm.inflight++
+}
+
+func (m *PrometheusMetrics) TaskFinished(header TaskHeader, elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tm := m.getTask(header)
+	tm.inflight--
+	tm.executions++
+	if err != nil {
+		tm.errors++
+		if errors.Is(err, context.DeadlineExceeded) {
+			tm.timeouts++
+		}
+	}
+
+	seconds := elapsed.Seconds()
+	i := sort.SearchFloat64s(m.buckets, seconds)
+	tm.counts[i]++
+	tm.sum += seconds
+}
+
+func (m *PrometheusMetrics) ActorStarted() {
+	m.mu.Lock()
+	m.actors++
+	m.mu.Unlock()
+}
+
+func (m *PrometheusMetrics) ActorStopped() {
+	m.mu.Lock()
+	m.actors--
+	m.mu.Unlock()
+}
+
+func (m *PrometheusMetrics) IteratorOpened() {
+	m.mu.Lock()
+	m.iterators++
+	m.mu.Unlock()
+}
+
+func (m *PrometheusMetrics) IteratorClosed() {
+	m.mu.Lock()
+	m.iterators--
+	m.mu.Unlock()
+}
+
+// getTask returns the metrics of the given task. The caller must hold m.mu.
+func (m *PrometheusMetrics) getTask(header TaskHeader) *taskMetrics {
+	key := taskKey{Type: header.Type, Name: header.Name}
+	tm, ok := m.tasks[key]
+	if !ok {
+		tm = &taskMetrics{counts: make([]int64, len(m.buckets)+1)}
+		m.tasks[key] = tm
+	}
+	return tm
+}
+
+// ServeHTTP writes the collected metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(m.render())
+}
+
+func (m *PrometheusMetrics) render() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Sort the tasks to get a stable output.
+	var keys []taskKey
+	for k := range m.tasks {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		return keys[i].Name < keys[j].Name
+	})
+
+	var buf bytes.Buffer
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(*taskMetrics) int64
+	}{
+		{"orchestrator_task_executions_total", "Total number of task executions.", func(tm *taskMetrics) int64 { return tm.executions }},
+		{"orchestrator_task_errors_total", "Total number of failed task executions.", func(tm *taskMetrics) int64 { return tm.errors }},
+		{"orchestrator_task_timeouts_total", "Total number of timed-out task executions.", func(tm *taskMetrics) int64 { return tm.timeouts }},
+	}
+	for _, c := range counters {
+		writeMetricHeader(&buf, c.name, c.help, "counter")
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "%s%s %d\n", c.name, labels(k, ""), c.value(m.tasks[k]))
+		}
+	}
+
+	writeMetricHeader(&buf, "orchestrator_task_inflight", "Number of task executions in flight.", "gauge")
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "orchestrator_task_inflight%s %d\n", labels(k, ""), m.tasks[k].inflight)
+	}
+
+	writeMetricHeader(&buf, "orchestrator_task_duration_seconds", "Latency of task executions.", "histogram")
+	for _, k := range keys {
+		tm := m.tasks[k]
+		var cumulative int64
+		for i, count := range tm.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(m.buckets) {
+				le = formatFloat(m.buckets[i])
+			}
+			fmt.Fprintf(&buf, "orchestrator_task_duration_seconds_bucket%s %d\n", labels(k, le), cumulative)
+		}
+		fmt.Fprintf(&buf, "orchestrator_task_duration_seconds_sum%s %s\n", labels(k, ""), formatFloat(tm.sum))
+		fmt.Fprintf(&buf, "orchestrator_task_duration_seconds_count%s %d\n", labels(k, ""), cumulative)
+	}
+
+	writeMetricHeader(&buf, "orchestrator_actors", "Number of live actors.", "gauge")
+	fmt.Fprintf(&buf, "orchestrator_actors %d\n", m.actors)
+
+	writeMetricHeader(&buf, "orchestrator_iterators", "Number of open iterators.", "gauge")
+	fmt.Fprintf(&buf, "orchestrator_iterators %d\n", m.iterators)
+
+	return buf.Bytes()
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, help, typ string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+}
+
+func labels(k taskKey, le string) string {
+	s := fmt.Sprintf(`{type="%s",name="%s"`, escapeLabelValue(k.Type), escapeLabelValue(k.Name))
+	if le != "" {
+		s += fmt.Sprintf(`,le="%s"`, le)
+	}
+	return s + "}"
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
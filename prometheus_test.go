@@ -0,0 +1,51 @@
+package orchestrator_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	flow := builtin.NewSerial("flow").Tasks(
+		builtin.NewFunc("ok").Func(func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+			return orchestrator.Output{}, nil
+		}),
+		builtin.NewSerial("slow").Timeout(10*time.Millisecond).Tasks(
+			builtin.NewFunc("sleep").Func(func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+				time.Sleep(50 * time.Millisecond)
+				return orchestrator.Output{}, nil
+			}),
+		),
+	).Build()
+
+	metrics := orchestrator.NewPrometheusMetrics(0.001, 1)
+	ctx := orchestrator.ContextWithMetrics(context.Background(), metrics)
+	if _, err := orchestrator.Instrument(flow).Execute(ctx, orchestrator.NewInput(nil)); err == nil {
+		t.Fatalf("Err: want timeout error")
+	}
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	got := w.Body.String()
+
+	for _, want := range []string{
+		`orchestrator_task_executions_total{type="func",name="ok"} 1`,
+		`orchestrator_task_executions_total{type="serial",name="flow"} 1`,
+		`orchestrator_task_errors_total{type="serial",name="flow"} 1`,
+		`orchestrator_task_timeouts_total{type="serial",name="slow"} 1`,
+		`orchestrator_task_inflight{type="serial",name="flow"} 0`,
+		`orchestrator_task_duration_seconds_bucket{type="serial",name="slow",le="1"} 1`,
+		`orchestrator_task_duration_seconds_count{type="func",name="ok"} 1`,
+		`orchestrator_actors 0`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("Metrics: missing %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Replay re-executes the given task with the given input, while stubbing all
+// the tasks of the given types to return their outputs recorded in the event
+// tree (typically produced by TraceTask or TraceFlow). All the other tasks,
+// as well as all expressions, are executed for real.
+//
+// Recorded events are matched by the task path. If a task is executed more
+// than once (e.g. the body of a Loop task), the recorded events of the same
+// path are used in order. A stubbed task with no recorded event left, or
+// whose recorded output has been truncated (see WithMaxOutputSize) or is an
+// iterator, will fail.
+//
+// Replay returns the event tree of the new execution, which can be compared
+// with the recorded one.
+func Replay(ctx context.Context, task Task, input Input, recorded Event, types ...string) Event {
+	r := &replay{
+		types:  make(map[string]bool),
+		events: make(map[string][]Event),
+	}
+	for _, typ := range types {
+		r.types[typ] = true
+	}
+	WalkEvents(recorded, func(path []string, e Event) {
+		key := strings.Join(path, "/")
+		r.events[key] = append(r.events[key], e)
+	})
+
+	return TraceTask(context.WithValue(ctx, replayKey{}, r), task, input)
+}
+
+type replayKey struct{}
+
+type replay struct {
+	types map[string]bool
+
+	mu     sync.Mutex
+	events map[string][]Event
+}
+
+// stub returns the recorded result of the current task, if the task should
+// be stubbed.
+func (r *replay) stub(ctx context.Context, header TaskHeader) (output Output, ok bool, err error) {
+	if !r.types[header.Type] {
+		return nil, false, nil
+	}
+
+	key := strings.Join(TaskPathFromContext(ctx), "/")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := r.events[key]
+	if len(events) == 0 {
+		return nil, true, fmt.Errorf("no recorded event left for task %q", key)
+	}
+	e := events[0]
+	r.events[key] = events[1:]
+
+	if IsTruncatedOutput(e.Output) {
+		return nil, true, fmt.Errorf("recorded output of task %q has been truncated", key)
+	}
+	// The items of an iterator are not recorded, and the recorded iterator
+	// itself (or its placeholder, once persisted) can not be consumed again.
+	if _, ok := Output(e.Output).Iterator(); ok || e.Output["iterator"] == (*Iterator)(nil).String() {
+		return nil, true, fmt.Errorf("recorded output of task %q is an iterator, which can not be replayed", key)
+	}
+
+	return e.Output, true, e.Error
+}
+
+// replayFromContext returns the replay carried by ctx, if any.
+func replayFromContext(ctx context.Context) *replay {
+	r, _ := ctx.Value(replayKey{}).(*replay)
+	return r
+}
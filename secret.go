@@ -0,0 +1,304 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedSecret is the mask that replaces resolved secret values.
+const RedactedSecret = "******"
+
+// MinSecretLength is the minimum length of a resolved secret value to be
+// tracked and masked.
+const MinSecretLength = 8
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider provides secrets by name.
+type SecretProvider interface {
+	// Secret returns the value of the secret with the given name.
+	Secret(name string) (string, error)
+}
+
+// DefaultSecretProvider is the provider used by the secret() expression
+// function. It defaults to EnvSecretProvider with no prefix.
+var DefaultSecretProvider SecretProvider = EnvSecretProvider{}
+
+// EnvSecretProvider reads secrets from environment variables, which are
+// named by Prefix followed by the secret name.
+type EnvSecretProvider struct {
+	Prefix string
+}
+
+func (p EnvSecretProvider) Secret(name string) (string, error) {
+	v, ok := os.LookupEnv(p.Prefix + name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return v, nil
+}
+
+// FileSecretProvider reads secrets from files in Dir, each of which is named
+// by the secret name (e.g. Docker or Kubernetes secrets mounted as files).
+// A trailing newline, if any, is trimmed.
+type FileSecretProvider struct {
+	Dir string
+}
+
+func (p FileSecretProvider) Secret(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) {
+		return "", fmt.Errorf("bad secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// MapSecretProvider holds secrets in memory, which is mainly useful for testing.
+type MapSecretProvider map[string]string
+
+func (p MapSecretProvider) Secret(name string) (string, error) {
+	v, ok := p[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return v, nil
+}
+
+// ResolveSecret gets the secret with the given name from DefaultSecretProvider.
+// The resolved value will be tracked and then masked (see Redact) wherever it
+// may leak, such as trace events, error messages and logs.
+//
+// Note that the tracked values are process-wide until ResetSecrets is called.
+// Values shorter than MinSecretLength are not tracked, since masking them
+// would mangle unrelated text (e.g. "1" or "true") everywhere, and a warning
+// is logged (through slog.Default) for each such secret instead.
+func ResolveSecret(name string) (string, error) {
+	v, err := DefaultSecretProvider.Secret(name)
+	if err != nil {
+		return "", err
+	}
+	if !secrets.add(v) {
+		secrets.warnShort(name)
+	}
+	return v, nil
+}
+
+// ResetSecrets forgets all the tracked secret values, which will no longer
+// be masked. It's typically used after the secrets have been rotated, to keep
+// the tracked values from growing indefinitely.
+func ResetSecrets() {
+	secrets.reset()
+}
+
+var secrets = &secretSet{values: make(map[string]bool), short: make(map[string]bool)}
+
+// secretSet tracks the resolved secret values.
+type secretSet struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+	// The names of the secrets that are too short to be tracked, which have
+	// been warned about.
+	short map[string]bool
+}
+
+// add tracks the given value, and reports whether the value is long enough
+// to be tracked.
+func (s *secretSet) add(v string) bool {
+	if len(v) < MinSecretLength {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.values[v] {
+		return true
+	}
+	s.values[v] = true
+
+	// Longer values go first, so that a value containing another one will be
+	// masked as a whole.
+	values := make([]string, 0, len(s.values))
+	for v := range s.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	oldnew := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		oldnew = append(oldnew, v, RedactedSecret)
+	}
+	s.replacer = strings.NewReplacer(oldnew...)
+	return true
+}
+
+// warnShort warns, only once for each name, that the secret of the given
+// name is too short to be masked.
+func (s *secretSet) warnShort(name string) {
+	s.mu.Lock()
+	warned := s.short[name]
+	s.short[name] = true
+	s.mu.Unlock()
+
+	if !warned {
+		slog.Warn("secret is too short to be masked", "name", name, "min_length", MinSecretLength)
+	}
+}
+
+func (s *secretSet) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = make(map[string]bool)
+	s.short = make(map[string]bool)
+	s.replacer = nil
+}
+
+func (s *secretSet) getReplacer() *strings.Replacer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.replacer
+}
+
+// Redact masks all the resolved secret values in s.
+func Redact(s string) string {
+	r := secrets.getReplacer()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// RedactError returns an error whose message has all the resolved secret
+// values masked. The original error can still be retrieved by errors.Is and
+// errors.As.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*redactedError); ok {
+		return err
+	}
+	msg := Redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, msg: msg}
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// RedactValue returns a copy of v in which all the resolved secret values
+// within strings have been masked. Maps and slices are traversed recursively,
+// and are only copied if they contain any secret value.
+func RedactValue(v any) any {
+	if v == nil || secrets.getReplacer() == nil {
+		return v
+	}
+	out, _ := redactValue(reflect.ValueOf(v))
+	return out.Interface()
+}
+
+// redactValue returns the redacted value, along with whether it differs from
+// the original one.
+func redactValue(v reflect.Value) (reflect.Value, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		s := Redact(v.String())
+		if s == v.String() {
+			return v, false
+		}
+		return reflect.ValueOf(s).Convert(v.Type()), true
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, changed := redactValue(v.Elem())
+		if !changed {
+			return v, false
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(elem)
+		return out, true
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v, false
+		}
+		var out reflect.Value
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, changed := redactValue(iter.Value())
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				// Copy the map on the first change.
+				out = reflect.MakeMapWithSize(v.Type(), v.Len())
+				copied := v.MapRange()
+				for copied.Next() {
+					out.SetMapIndex(copied.Key(), copied.Value())
+				}
+			}
+			out.SetMapIndex(iter.Key(), elem)
+		}
+		if !out.IsValid() {
+			return v, false
+		}
+		return out, true
+
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 {
+			// Leave byte slices as is.
+			return v, false
+		}
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			elem, changed := redactValue(v.Index(i))
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				// Copy the slice on the first change.
+				out = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+				reflect.Copy(out, v)
+			}
+			out.Index(i).Set(elem)
+		}
+		if !out.IsValid() {
+			return v, false
+		}
+		return out, true
+
+	default:
+		return v, false
+	}
+}
+
+// redactOutput is a shortcut of RedactValue for outputs.
+func redactOutput(output map[string]any) map[string]any {
+	if output == nil {
+		return nil
+	}
+	return RedactValue(output).(map[string]any)
+}
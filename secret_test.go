@@ -0,0 +1,187 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+func TestSecretProvider(t *testing.T) {
+	t.Setenv("TEST_SECRET_TOKEN", "env-token")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("file-token\n"), 0600); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		inProvider orchestrator.SecretProvider
+		wantValue  string
+	}{
+		{
+			name:       "env",
+			inProvider: orchestrator.EnvSecretProvider{Prefix: "TEST_SECRET_"},
+			wantValue:  "env-token",
+		},
+		{
+			name:       "file",
+			inProvider: orchestrator.FileSecretProvider{Dir: dir},
+			wantValue:  "file-token",
+		},
+		{
+			name:       "map",
+			inProvider: orchestrator.MapSecretProvider{"TOKEN": "map-token"},
+			wantValue:  "map-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "TOKEN"
+			if tt.name == "file" {
+				name = "token"
+			}
+			got, err := tt.inProvider.Secret(name)
+			if err != nil {
+				t.Fatalf("Err: %v", err)
+			}
+			if got != tt.wantValue {
+				t.Fatalf("Value: Got (%s) != Want (%s)", got, tt.wantValue)
+			}
+
+			if _, err := tt.inProvider.Secret("missing"); !errors.Is(err, orchestrator.ErrSecretNotFound) {
+				t.Fatalf("Err: Got (%v) != Want (%v)", err, orchestrator.ErrSecretNotFound)
+			}
+		})
+	}
+}
+
+func TestSecret_Redaction(t *testing.T) {
+	defer func(p orchestrator.SecretProvider) { orchestrator.DefaultSecretProvider = p }(orchestrator.DefaultSecretProvider)
+	orchestrator.DefaultSecretProvider = orchestrator.MapSecretProvider{"api_key": "k3y-1234567890"}
+
+	// The secret is available in both Starlark and Expr expressions.
+	for _, s := range []string{`${secret("api_key")}`, `#{secret("api_key")}`} {
+		got, err := orchestrator.NewEvaluator().Evaluate(s)
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		if got != "k3y-1234567890" {
+			t.Fatalf("Value: Got (%v) != Want (k3y-1234567890)", got)
+		}
+	}
+
+	errBase := errors.New("unauthorized")
+	flow := builtin.NewSerial("flow").Tasks(
+		builtin.NewFunc("echo").Func(func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+			return orchestrator.Output{
+				"header": map[string][]string{"Authorization": {"Bearer k3y-1234567890"}},
+			}, nil
+		}),
+		builtin.NewFunc("fail").Func(func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+			return nil, fmt.Errorf("bad key k3y-1234567890: %w", errBase)
+		}),
+	).Build()
+
+	event := orchestrator.TraceTask(context.Background(), flow, orchestrator.NewInput(nil))
+
+	header := event.Events[0].Output["header"].(map[string][]string)
+	if got := header["Authorization"][0]; got != "Bearer ******" {
+		t.Fatalf("Output: Got (%s) != Want (Bearer ******)", got)
+	}
+	for _, err := range []error{event.Error, event.Events[1].Error} {
+		if got := err.Error(); got != "bad key ******: unauthorized" {
+			t.Fatalf("Error: Got (%s) != Want (bad key ******: unauthorized)", got)
+		}
+		if !errors.Is(err, errBase) {
+			t.Fatalf("Error: not wrapping the original error")
+		}
+	}
+
+	// Secrets are also masked in the string representations of tasks.
+	task := builtin.NewHTTP("get").Get("https://example.com").Header("Authorization", "Bearer k3y-1234567890").Build()
+	if got := fmt.Sprint(task); strings.Contains(got, "k3y-1234567890") || !strings.Contains(got, "Bearer ******") {
+		t.Fatalf("String: Got (%s) != Want (containing Bearer ******)", got)
+	}
+}
+
+func TestRedactValue(t *testing.T) {
+	defer func(p orchestrator.SecretProvider) { orchestrator.DefaultSecretProvider = p }(orchestrator.DefaultSecretProvider)
+	orchestrator.DefaultSecretProvider = orchestrator.MapSecretProvider{
+		"long":  "s3cret-value",
+		"short": "true",
+	}
+	for _, name := range []string{"long", "short"} {
+		if _, err := orchestrator.ResolveSecret(name); err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+	}
+
+	// Short values are not masked.
+	if got := orchestrator.Redact("true: s3cret-value"); got != "true: ******" {
+		t.Fatalf("Redact: Got (%s) != Want (true: ******)", got)
+	}
+
+	// Values without secrets are not copied.
+	clean := map[string]any{"list": []any{"a", 1}}
+	if got := orchestrator.RedactValue(clean).(map[string]any); fmt.Sprintf("%p", got) != fmt.Sprintf("%p", clean) {
+		t.Fatal("RedactValue: copied a value without secrets")
+	}
+
+	dirty := map[string]any{"list": []any{"a", "s3cret-value"}, "n": 1}
+	got := orchestrator.RedactValue(dirty).(map[string]any)
+	if list := got["list"].([]any); list[0] != "a" || list[1] != "******" || got["n"] != 1 {
+		t.Fatalf("RedactValue: Got (%v)", got)
+	}
+	if dirty["list"].([]any)[1] != "s3cret-value" {
+		t.Fatal("RedactValue: modified the original value")
+	}
+}
+
+func TestResolveSecret_Short(t *testing.T) {
+	defer func(p orchestrator.SecretProvider) { orchestrator.DefaultSecretProvider = p }(orchestrator.DefaultSecretProvider)
+	orchestrator.DefaultSecretProvider = orchestrator.MapSecretProvider{"pin": "1234"}
+	// Forget the warnings of previous runs.
+	orchestrator.ResetSecrets()
+
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	// The warning is logged only once.
+	for i := 0; i < 2; i++ {
+		if _, err := orchestrator.ResolveSecret("pin"); err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+	}
+	want := `level=WARN msg="secret is too short to be masked" name=pin min_length=8`
+	if got := buf.String(); strings.Count(got, want) != 1 || strings.Count(got, "\n") != 1 {
+		t.Fatalf("Log: Got (%q) != Want (containing %q once)", got, want)
+	}
+}
+
+func TestResetSecrets(t *testing.T) {
+	defer func(p orchestrator.SecretProvider) { orchestrator.DefaultSecretProvider = p }(orchestrator.DefaultSecretProvider)
+	orchestrator.DefaultSecretProvider = orchestrator.MapSecretProvider{"old": "0ld-s3cret-value"}
+
+	if _, err := orchestrator.ResolveSecret("old"); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if got := orchestrator.Redact("0ld-s3cret-value"); got != "******" {
+		t.Fatalf("Redact: Got (%s) != Want (******)", got)
+	}
+
+	orchestrator.ResetSecrets()
+	if got := orchestrator.Redact("0ld-s3cret-value"); got != "0ld-s3cret-value" {
+		t.Fatalf("Redact: Got (%s) != Want (0ld-s3cret-value)", got)
+	}
+}
@@ -3,6 +3,7 @@ package orchestrator
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 
 	//"go.starlark.net/lib/json"
@@ -83,6 +84,18 @@ func (si *starlarkIterator) Iterator() *Iterator {
 	return si.iter
 }
 
+// starlarkReader serves as an opaque Starlark representation of an io.Reader
+// (e.g. a lazy response body), which can only be passed around.
+type starlarkReader struct {
+	r io.Reader
+}
+
+func (sr *starlarkReader) String() string        { return "io.Reader" }
+func (sr *starlarkReader) Type() string          { return sr.String() }
+func (sr *starlarkReader) Freeze()               {} // immutable
+func (sr *starlarkReader) Truth() starlark.Bool  { return starlark.True }
+func (sr *starlarkReader) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable: %s", sr.Type()) }
+
 func StarlarkEvalExpr(s string, env map[string]any) (any, error) {
 	expr, err := syntax.ParseExpr("", s, 0)
 	if err != nil {
@@ -100,6 +113,7 @@ func StarlarkEvalExpr(s string, env map[string]any) (any, error) {
 
 	// Add pre-declared functions.
 	envDict["getenv"] = starlark.NewBuiltin("getenv", getEnv)
+	envDict["secret"] = starlark.NewBuiltin("secret", getSecret)
 	envDict["isiterator"] = starlark.NewBuiltin("isiterator", isIterator)
 	envDict["jsonencode"] = starlark.NewBuiltin("jsonencode", encode)
 	envDict["jsondecode"] = starlark.NewBuiltin("jsondecode", decode)
@@ -116,6 +130,7 @@ func StarlarkCallFunc(s string, env map[string]any) (any, error) {
 	// Add pre-declared functions.
 	predeclared := starlark.StringDict{
 		"getenv":     starlark.NewBuiltin("getenv", getEnv),
+		"secret":     starlark.NewBuiltin("secret", getSecret),
 		"isiterator": starlark.NewBuiltin("isiterator", isIterator),
 		"jsonencode": starlark.NewBuiltin("jsonencode", encode),
 		"jsondecode": starlark.NewBuiltin("jsondecode", decode),
@@ -156,6 +171,19 @@ func getEnv(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, k
 	return starlark.String(v), nil
 }
 
+func getSecret(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+
+	v, err := ResolveSecret(name)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(v), nil
+}
+
 func isIterator(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var v starlark.Value
 	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "v", &v); err != nil {
@@ -213,6 +241,9 @@ func starlarkValueAsInterface(value starlark.Value) (any, error) {
 	case *starlarkIterator:
 		return v.Iterator(), nil
 
+	case *starlarkReader:
+		return v.r, nil
+
 	default:
 		return nil, fmt.Errorf("%w: unsupported type %T", ErrStarlarkConversion, value)
 	}
@@ -258,6 +289,9 @@ func interfaceAsStarlarkValue(value any) (starlark.Value, error) {
 	case *Iterator:
 		return newStarlarkIterator(v), nil
 
+	case io.Reader:
+		return &starlarkReader{r: v}, nil
+
 	default:
 		var m map[string]any
 		if err := DefaultCodec.Decode(v, &m); err == nil {
@@ -3,16 +3,28 @@ package orchestrator
 import (
 	"context"
 	"encoding/json"
+	"math/rand"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/RussellLuo/structool"
 )
 
-var traceEncoder = structool.New().TagName("json").EncodeHook(
-	structool.EncodeTimeToString("2006-01-02T15:04:05.000000Z07:00"),
-	structool.EncodeDurationToString,
-	structool.EncodeErrorToString,
+const traceTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+var (
+	traceEncoder = structool.New().TagName("json").EncodeHook(
+		structool.EncodeTimeToString(traceTimeLayout),
+		structool.EncodeDurationToString,
+		structool.EncodeErrorToString,
+	)
+	traceDecoder = structool.New().TagName("json").DecodeHook(
+		structool.DecodeStringToTime(traceTimeLayout),
+		structool.DecodeStringToDuration,
+		structool.DecodeStringToError,
+	)
 )
 
 // Event is the individual component of a trace. It represents a single
@@ -21,13 +33,21 @@ type Event struct {
 	When time.Time `json:"when"`
 	// Since the previous event in the trace.
 	Elapsed time.Duration `json:"elapsed"`
+	// The execution time of the task.
+	Duration time.Duration `json:"duration"`
 
 	Name   string         `json:"name"`
+	Type   string         `json:"type,omitempty"`
 	Output map[string]any `json:"output,omitempty"`
 	Error  error          `json:"error,omitempty"`
 
 	// Events hold the events of the child trace, if any.
 	Events []Event `json:"events,omitempty"`
+	// Truncated indicates that some events of the child trace have been
+	// dropped due to the maximum number of events (see WithMaxEvents).
+	Truncated bool `json:"truncated,omitempty"`
+	// CacheHit indicates that the output is from the cache (see ContextWithCache).
+	CacheHit bool `json:"cache_hit,omitempty"`
 }
 
 // Map converts an event to a map.
@@ -39,6 +59,11 @@ func (e Event) Map() (map[string]any, error) {
 	return out.(map[string]any), nil
 }
 
+// Start returns the time when the task started executing.
+func (e Event) Start() time.Time {
+	return e.When.Add(-e.Duration)
+}
+
 func (e Event) MarshalJSON() ([]byte, error) {
 	m, err := e.Map()
 	if err != nil {
@@ -47,6 +72,16 @@ func (e Event) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	// Reset the event before decoding.
+	*e = Event{}
+	return traceDecoder.Decode(m, e)
+}
+
 // Trace provides tracing for the execution of a composite task.
 type Trace interface {
 	// New creates a child trace of the current trace. A child trace
@@ -78,20 +113,129 @@ func TraceFromContext(ctx context.Context) Trace {
 }
 
 func NewTrace(name string) Trace {
+	return newTrace(name, &traceLimits{})
+}
+
+func newTrace(name string, limits *traceLimits) *trace {
 	return &trace{
 		name:     name,
 		start:    time.Now(),
+		limits:   limits,
 		children: make(map[string]Trace),
 	}
 }
 
+// TraceOption configures the tracing performed by TraceTask.
+type TraceOption func(*traceOptions)
+
+type traceOptions struct {
+	sampleRate float64
+	limits     traceLimits
+}
+
+// WithSampleRate sets the probability, within [0, 1], that an execution is
+// traced. An execution that is not sampled only reports the task's own event,
+// without any child events, and is not saved into the trace store. Defaults
+// to 1, i.e. all executions are traced.
+func WithSampleRate(rate float64) TraceOption {
+	return func(o *traceOptions) { o.sampleRate = rate }
+}
+
+// WithMaxEvents sets the maximum number of events (excluding the task's own
+// event) recorded in a trace. Once the limit is reached, subsequent events
+// are dropped and their parent events are marked as truncated. Zero means
+// no limit.
+func WithMaxEvents(n int) TraceOption {
+	return func(o *traceOptions) { o.limits.maxEvents = int64(n) }
+}
+
+// WithMaxOutputSize sets the maximum size, in bytes, of the JSON-serialized
+// output of each event. A larger output is replaced by a truncation marker
+// (see TruncatedOutputKey) carrying its original size and a preview. Zero
+// means no limit.
+func WithMaxOutputSize(n int) TraceOption {
+	return func(o *traceOptions) { o.limits.maxOutputSize = n }
+}
+
+// TruncatedOutputKey is the key of the truncation marker, which replaces an
+// output exceeding the maximum output size. For example:
+//
+//	{"__truncated__": {"size": 1048576, "preview": "{\"body\": ..."}}
+const TruncatedOutputKey = "__truncated__"
+
+// IsTruncatedOutput reports whether the given output is a truncation marker.
+func IsTruncatedOutput(output map[string]any) bool {
+	_, ok := output[TruncatedOutputKey]
+	return ok
+}
+
+type traceLimits struct {
+	maxEvents     int64
+	maxOutputSize int
+
+	// The number of events recorded so far, which is shared by the whole
+	// trace tree.
+	events atomic.Int64
+}
+
+// allow reports whether one more event can be recorded.
+func (l *traceLimits) allow() bool {
+	return l.maxEvents <= 0 || l.events.Add(1) <= l.maxEvents
+}
+
+// truncate replaces the given output by a truncation marker, if its size
+// exceeds the maximum output size.
+func (l *traceLimits) truncate(output map[string]any) map[string]any {
+	if l.maxOutputSize <= 0 || output == nil {
+		return output
+	}
+	data, err := json.Marshal(output)
+	if err != nil || len(data) <= l.maxOutputSize {
+		return output
+	}
+	return map[string]any{
+		TruncatedOutputKey: map[string]any{
+			"size":    len(data),
+			"preview": strings.ToValidUTF8(string(data[:l.maxOutputSize]), ""),
+		},
+	}
+}
+
 // TraceTask traces the execution of the task with the given input, and
 // reports the tracing result.
-func TraceTask(ctx context.Context, task Task, input Input) Event {
-	tr := NewTrace("root")
-	ctx = ContextWithTrace(ctx, tr)
+//
+// If ctx carries a trace store (see ContextWithTraceStore), the tracing
+// result will also be saved into the store.
+//
+// Tracing can be tuned by options (e.g. WithSampleRate). Besides, a task
+// can opt out of tracing by setting the "disable_trace" header field, in
+// which case neither the task nor its sub-tasks will be recorded. If the task
+// itself opts out, only its own event is reported, just like an execution
+// that is not sampled.
+func TraceTask(ctx context.Context, task Task, input Input, opts ...TraceOption) Event {
+	o := traceOptions{sampleRate: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	header := task.Header()
+	if header.DisableTrace || (o.sampleRate < 1 && rand.Float64() >= o.sampleRate) {
+		// Not traced, only report the task's own event.
+		start := time.Now()
+		output, err := Instrument(task).Execute(ContextWithTrace(ctx, nilTrace{}), input)
+		return Event{
+			When:     time.Now(),
+			Duration: time.Since(start),
+			Name:     header.Name,
+			Type:     header.Type,
+			Output:   o.limits.truncate(output),
+			Error:    err,
+		}
+	}
 
-	_, _ = tr.Wrap(task).Execute(ctx, input)
+	tr := newTrace("root", &o.limits)
+	tr.root = true
+	_, _ = tr.Wrap(Instrument(task)).Execute(ContextWithTrace(ctx, tr), input)
 
 	// To be intuitive, only expose the task's single event.
 	//
@@ -99,20 +243,30 @@ func TraceTask(ctx context.Context, task Task, input Input) Event {
 	//  ^       ^
 	// tr      .Events()[0]
 	//
-	return tr.Events()[0]
+	event := tr.Events()[0]
+
+	if err := SaveTrace(ctx, event); err != nil {
+		Log(ctx, err, "failed to save trace")
+	}
+	return event
 }
 
 type trace struct {
-	name  string
-	start time.Time
+	name   string
+	start  time.Time
+	limits *traceLimits
+	// The root trace always records the task's own event, regardless of
+	// the limits.
+	root bool
 
-	mu       sync.RWMutex
-	children map[string]Trace
-	events   []Event
+	mu        sync.RWMutex
+	children  map[string]Trace
+	events    []Event
+	truncated bool
 }
 
 func (tr *trace) New(name string) Trace {
-	child := NewTrace(name)
+	child := newTrace(name, tr.limits)
 	tr.mu.Lock()
 	tr.children[name] = child
 	tr.mu.Unlock()
@@ -120,31 +274,52 @@ func (tr *trace) New(name string) Trace {
 }
 
 func (tr *trace) Wrap(task Task) Task {
-	return traceTask{Task: task}
+	return traceTask{Task: task, tr: tr}
 }
 
 func (tr *trace) AddEvent(name string, output map[string]any, err error) {
-	when := time.Now()
+	if !tr.allow() {
+		return
+	}
+	tr.addEvent(Event{
+		Name:   name,
+		Output: output,
+		Error:  err,
+	})
+}
 
+// allow reports whether one more event can be recorded into the trace, and
+// marks the trace as truncated if not.
+func (tr *trace) allow() bool {
+	if tr.root || tr.limits.allow() {
+		return true
+	}
 	tr.mu.Lock()
-	var events []Event
-	if child, ok := tr.children[name]; ok {
+	tr.truncated = true
+	tr.mu.Unlock()
+	return false
+}
+
+func (tr *trace) addEvent(event Event) {
+	event.When = time.Now()
+	event.Output = tr.limits.truncate(redactOutput(event.Output))
+	event.Error = RedactError(event.Error)
+
+	tr.mu.Lock()
+	if child, ok := tr.children[event.Name]; ok {
 		// The current event to add is associated with a child trace, whose
 		// events should be attached to the event.
 		//
 		// Since currently we only record the output of the task, it's guaranteed
 		// that the task has completed, which means that all events of its children
 		// traces, if any, have already been populated.
-		events = child.Events()
-	}
-	tr.events = append(tr.events, Event{
-		When:    when,
-		Elapsed: tr.delta(when),
-		Name:    name,
-		Output:  output,
-		Error:   err,
-		Events:  events,
-	})
+		event.Events = child.Events()
+		if c, ok := child.(*trace); ok {
+			event.Truncated = c.isTruncated()
+		}
+	}
+	event.Elapsed = tr.delta(event.When)
+	tr.events = append(tr.events, event)
 	tr.mu.Unlock()
 }
 
@@ -154,6 +329,12 @@ func (tr *trace) Events() []Event {
 	return tr.events
 }
 
+func (tr *trace) isTruncated() bool {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	return tr.truncated
+}
+
 func (tr *trace) delta(t time.Time) time.Duration {
 	if len(tr.events) == 0 {
 		return t.Sub(tr.start)
@@ -164,15 +345,66 @@ func (tr *trace) delta(t time.Time) time.Duration {
 
 type traceTask struct {
 	Task
+	tr *trace
 }
 
 func (t traceTask) Execute(ctx context.Context, input Input) (Output, error) {
-	trace := TraceFromContext(ctx)
-	output, err := t.Task.Execute(ctx, input)
-	trace.AddEvent(t.Task.Header().Name, output, err)
+	header := t.Task.Header()
+	if header.DisableTrace {
+		// Neither the task nor its sub-tasks will be recorded.
+		return t.Task.Execute(ContextWithTrace(ctx, nilTrace{}), input)
+	}
+
+	// Count the event when the task starts rather than when it completes,
+	// so that the events of ancestors take precedence over those of their
+	// descendants, which complete earlier.
+	if !t.tr.allow() {
+		// The event will be dropped, so will the events of the sub-tasks.
+		return t.Task.Execute(ContextWithTrace(ctx, nilTrace{}), input)
+	}
+
+	note := new(eventNote)
+	start := time.Now()
+	output, err := t.Task.Execute(contextWithEventNote(ctx, note), input)
+
+	t.tr.addEvent(Event{
+		Duration: time.Since(start),
+		Name:     header.Name,
+		Type:     header.Type,
+		Output:   output,
+		Error:    err,
+		CacheHit: note.isCacheHit(),
+	})
 	return output, err
 }
 
+type eventNoteKey struct{}
+
+// eventNote collects the extra information of the event of a task, which is
+// reported by Instrument.
+type eventNote struct {
+	cacheHit atomic.Bool
+}
+
+func (n *eventNote) setCacheHit() {
+	if n != nil {
+		n.cacheHit.Store(true)
+	}
+}
+
+func (n *eventNote) isCacheHit() bool {
+	return n != nil && n.cacheHit.Load()
+}
+
+func contextWithEventNote(ctx context.Context, note *eventNote) context.Context {
+	return context.WithValue(ctx, eventNoteKey{}, note)
+}
+
+func eventNoteFromContext(ctx context.Context) *eventNote {
+	note, _ := ctx.Value(eventNoteKey{}).(*eventNote)
+	return note
+}
+
 type nilTrace struct{}
 
 func (tr nilTrace) New(name string) Trace                                  { return tr }
@@ -0,0 +1,133 @@
+package orchestrator_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+// taskBuilder turns a built task back into a builder.
+type taskBuilder struct{ orchestrator.Task }
+
+func (b taskBuilder) Build() orchestrator.Task { return b.Task }
+
+func TestTraceTask_Options(t *testing.T) {
+	newFunc := func(name string) *builtin.Func {
+		return builtin.NewFunc(name).Func(func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+			return orchestrator.Output{"body": strings.Repeat("x", 100)}, nil
+		}).Build().(*builtin.Func)
+	}
+	newFlow := func() orchestrator.Task {
+		hidden := newFunc("hidden")
+		hidden.DisableTrace = true
+		return builtin.NewSerial("flow").Tasks(
+			taskBuilder{newFunc("a")},
+			taskBuilder{hidden},
+			taskBuilder{newFunc("b")},
+			taskBuilder{newFunc("c")},
+		).Build()
+	}
+
+	t.Run("disable trace", func(t *testing.T) {
+		event := orchestrator.TraceTask(context.Background(), newFlow(), orchestrator.NewInput(nil))
+		var names []string
+		for _, e := range event.Events {
+			names = append(names, e.Name)
+		}
+		if got := strings.Join(names, ","); got != "a,b,c" {
+			t.Fatalf("Events: Got (%s) != Want (a,b,c)", got)
+		}
+		if event.Truncated {
+			t.Fatalf("Truncated: Got (true) != Want (false)")
+		}
+	})
+
+	t.Run("max events", func(t *testing.T) {
+		event := orchestrator.TraceTask(context.Background(), newFlow(), orchestrator.NewInput(nil),
+			orchestrator.WithMaxEvents(2),
+		)
+		if len(event.Events) != 2 {
+			t.Fatalf("Events: Got (%d) != Want (2)", len(event.Events))
+		}
+		if !event.Truncated {
+			t.Fatalf("Truncated: Got (false) != Want (true)")
+		}
+	})
+
+	t.Run("max events with nested tasks", func(t *testing.T) {
+		flow := builtin.NewSerial("flow").Tasks(
+			builtin.NewSerial("inner").Tasks(
+				taskBuilder{newFunc("x")},
+				taskBuilder{newFunc("y")},
+				taskBuilder{newFunc("z")},
+			),
+			taskBuilder{newFunc("a")},
+		).Build()
+		event := orchestrator.TraceTask(context.Background(), flow, orchestrator.NewInput(nil),
+			orchestrator.WithMaxEvents(2),
+		)
+
+		// The parent event takes precedence over those of its children.
+		if len(event.Events) != 1 || event.Events[0].Name != "inner" {
+			t.Fatalf("Events: Got (%+v) != Want (inner)", event.Events)
+		}
+		inner := event.Events[0]
+		if len(inner.Events) != 1 || inner.Events[0].Name != "x" {
+			t.Fatalf("Events of inner: Got (%+v) != Want (x)", inner.Events)
+		}
+		if !event.Truncated || !inner.Truncated {
+			t.Fatalf("Truncated: Got (%v, %v) != Want (true, true)", event.Truncated, inner.Truncated)
+		}
+	})
+
+	t.Run("max output size", func(t *testing.T) {
+		event := orchestrator.TraceTask(context.Background(), newFlow(), orchestrator.NewInput(nil),
+			orchestrator.WithMaxOutputSize(50),
+		)
+		for _, e := range event.Events {
+			if !orchestrator.IsTruncatedOutput(e.Output) {
+				t.Fatalf("Output of %s: not truncated", e.Name)
+			}
+			marker := e.Output[orchestrator.TruncatedOutputKey].(map[string]any)
+			if size := marker["size"]; size != 111 {
+				t.Fatalf("Size: Got (%v) != Want (111)", size)
+			}
+			if preview := marker["preview"].(string); len(preview) != 50 {
+				t.Fatalf("Preview: Got (%d bytes) != Want (50 bytes)", len(preview))
+			}
+		}
+	})
+
+	t.Run("disable trace of the task itself", func(t *testing.T) {
+		flow := newFlow()
+		flow.(*builtin.Serial).DisableTrace = true
+		event := orchestrator.TraceTask(context.Background(), flow, orchestrator.NewInput(nil))
+		if event.Name != "flow" || len(event.Events) != 0 {
+			t.Fatalf("Event: Got (%s with %d events) != Want (flow with 0 events)", event.Name, len(event.Events))
+		}
+		if event.Error != nil || event.Output["body"] == nil {
+			t.Fatalf("Result: Got (%v, %v)", event.Output, event.Error)
+		}
+	})
+
+	t.Run("not sampled", func(t *testing.T) {
+		store := orchestrator.NewMemoryTraceStore()
+		ctx := orchestrator.ContextWithTraceStore(context.Background(), store)
+		event := orchestrator.TraceTask(ctx, newFlow(), orchestrator.NewInput(nil),
+			orchestrator.WithSampleRate(0),
+		)
+		if event.Name != "flow" || len(event.Events) != 0 {
+			t.Fatalf("Event: Got (%s with %d events) != Want (flow with 0 events)", event.Name, len(event.Events))
+		}
+		records, err := store.Query(ctx, orchestrator.TraceQuery{})
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		if len(records) != 0 {
+			t.Fatalf("Records: Got (%d) != Want (0)", len(records))
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// HeaderTraceParent is the HTTP header which carries the identity of
+	// the incoming request in a tracing system.
+	HeaderTraceParent = "traceparent"
+
+	// HeaderTraceState is the HTTP header which carries the vendor-specific
+	// trace identification data.
+	HeaderTraceState = "tracestate"
+)
+
+// TraceContext identifies the span of an execution in a distributed trace,
+// as defined by W3C Trace Context (https://www.w3.org/TR/trace-context/).
+//
+// Note that TraceContext is unrelated to Trace, which records the events of
+// an execution locally.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	State   string
+}
+
+// NewTraceContext creates a sampled trace context which starts a new trace.
+func NewTraceContext() TraceContext {
+	var tc TraceContext
+	_, _ = rand.Read(tc.TraceID[:])
+	_, _ = rand.Read(tc.SpanID[:])
+	tc.Flags = 0x01 // sampled
+	return tc
+}
+
+// ParseTraceContext parses the values of the traceparent and tracestate
+// headers into a trace context.
+func ParseTraceContext(traceparent, tracestate string) (TraceContext, error) {
+	var tc TraceContext
+
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, fmt.Errorf("bad traceparent %q", traceparent)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return tc, fmt.Errorf("bad traceparent %q", traceparent)
+	}
+
+	if err := decodeHex(parts[1], tc.TraceID[:]); err != nil {
+		return tc, fmt.Errorf("bad trace-id in traceparent %q", traceparent)
+	}
+	if err := decodeHex(parts[2], tc.SpanID[:]); err != nil {
+		return tc, fmt.Errorf("bad parent-id in traceparent %q", traceparent)
+	}
+	var flags [1]byte
+	if err := decodeHex(parts[3], flags[:]); err != nil {
+		return tc, fmt.Errorf("bad trace-flags in traceparent %q", traceparent)
+	}
+	tc.Flags = flags[0]
+	tc.State = strings.TrimSpace(tracestate)
+
+	if !tc.IsValid() {
+		return tc, fmt.Errorf("bad traceparent %q", traceparent)
+	}
+	return tc, nil
+}
+
+// TraceContextFromHeader parses the trace context from the headers of an
+// incoming HTTP request.
+func TraceContextFromHeader(header http.Header) (TraceContext, error) {
+	return ParseTraceContext(header.Get(HeaderTraceParent), header.Get(HeaderTraceState))
+}
+
+// IsValid reports whether both the trace ID and the span ID are non-zero.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// NewSpan returns a child trace context, which belongs to the same trace
+// but has a new span ID.
+func (tc TraceContext) NewSpan() TraceContext {
+	child := tc
+	_, _ = rand.Read(child.SpanID[:])
+	return child
+}
+
+// TraceParent returns the value of the traceparent header.
+func (tc TraceContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(tc.TraceID[:]), hex.EncodeToString(tc.SpanID[:]), tc.Flags)
+}
+
+func decodeHex(s string, dst []byte) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return fmt.Errorf("bad length or case")
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+type traceContextKey struct{}
+
+// ContextWithTraceContext returns a copy of ctx which carries the trace context tc.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext returns the trace context carried by ctx, if any.
+func TraceContextFromContext(ctx context.Context) (tc TraceContext, ok bool) {
+	tc, ok = ctx.Value(traceContextKey{}).(TraceContext)
+	return
+}
@@ -0,0 +1,57 @@
+package orchestrator_test
+
+import (
+	"testing"
+
+	"github.com/RussellLuo/orchestrator"
+)
+
+func TestParseTraceContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		inParent    string
+		inState     string
+		wantParent  string
+		wantErrFlag bool
+	}{
+		{
+			name:       "ok",
+			inParent:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			inState:    "rojo=00f067aa0ba902b7",
+			wantParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		{
+			name:        "zero trace id",
+			inParent:    "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			wantErrFlag: true,
+		},
+		{
+			name:        "upper case",
+			inParent:    "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01",
+			wantErrFlag: true,
+		},
+		{
+			name:        "malformed",
+			inParent:    "00-4bf92f3577b34da6a3ce929d0e0e4736-01",
+			wantErrFlag: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, err := orchestrator.ParseTraceContext(tt.inParent, tt.inState)
+			if (err != nil) != tt.wantErrFlag {
+				t.Fatalf("Err: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if tc.TraceParent() != tt.wantParent {
+				t.Fatalf("TraceParent: Got (%q) != Want (%q)", tc.TraceParent(), tt.wantParent)
+			}
+			if tc.State != tt.inState {
+				t.Fatalf("State: Got (%q) != Want (%q)", tc.State, tt.inState)
+			}
+		})
+	}
+}
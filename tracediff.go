@@ -0,0 +1,280 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DiffKind string
+
+const (
+	DiffAdded     DiffKind = "added"
+	DiffRemoved   DiffKind = "removed"
+	DiffChanged   DiffKind = "changed"
+	DiffUnchanged DiffKind = "unchanged"
+)
+
+// ValueDiff is a difference between two JSON values.
+type ValueDiff struct {
+	// Path locates the value, e.g. "body.items[0].id".
+	Path string   `json:"path"`
+	Kind DiffKind `json:"kind"`
+	Old  any      `json:"old,omitempty"`
+	New  any      `json:"new,omitempty"`
+}
+
+// EventDiff is the difference between two aligned events.
+type EventDiff struct {
+	// Path is the task path of the event. If a task is executed more than
+	// once (e.g. the body of a Loop task), "#n" is appended to indicate the
+	// n-th (zero-based) execution.
+	Path string   `json:"path"`
+	Kind DiffKind `json:"kind"`
+
+	// Output holds the structural differences between the outputs.
+	Output   []ValueDiff `json:"output,omitempty"`
+	OldError string      `json:"old_error,omitempty"`
+	NewError string      `json:"new_error,omitempty"`
+
+	OldDuration time.Duration `json:"old_duration"`
+	NewDuration time.Duration `json:"new_duration"`
+}
+
+// LatencyDelta returns the difference between the new and the old durations.
+func (d EventDiff) LatencyDelta() time.Duration {
+	return d.NewDuration - d.OldDuration
+}
+
+// TraceDiff is the difference between two event trees, ordered by the
+// execution order of the events.
+type TraceDiff []EventDiff
+
+// DiffEvents compares two event trees. Events are aligned by their task
+// paths, as well as by their execution order for the same path.
+func DiffEvents(old, cur Event) TraceDiff {
+	oldEvents, oldKeys := indexEvents(old)
+	newEvents, newKeys := indexEvents(cur)
+
+	// Keep the order of the old events, with the added events following.
+	keys := oldKeys
+	for _, k := range newKeys {
+		if _, ok := oldEvents[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	var diff TraceDiff
+	for _, k := range keys {
+		o, inOld := oldEvents[k]
+		n, inNew := newEvents[k]
+
+		d := EventDiff{Path: k}
+		switch {
+		case !inNew:
+			d.Kind = DiffRemoved
+			d.OldDuration, d.OldError = o.Duration, errorString(o.Error)
+		case !inOld:
+			d.Kind = DiffAdded
+			d.NewDuration, d.NewError = n.Duration, errorString(n.Error)
+		default:
+			d.OldDuration, d.NewDuration = o.Duration, n.Duration
+			d.OldError, d.NewError = errorString(o.Error), errorString(n.Error)
+			d.Output = DiffValues(o.Output, n.Output)
+
+			d.Kind = DiffUnchanged
+			if len(d.Output) > 0 || d.OldError != d.NewError {
+				d.Kind = DiffChanged
+			}
+		}
+		diff = append(diff, d)
+	}
+	return diff
+}
+
+// HasChanges reports whether there are any added, removed or changed events.
+// Note that latency differences are not considered as changes.
+func (d TraceDiff) HasChanges() bool {
+	for _, e := range d {
+		if e.Kind != DiffUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a human-readable report of the differences.
+func (d TraceDiff) String() string {
+	var b strings.Builder
+
+	b.WriteString("Changes:\n")
+	if !d.HasChanges() {
+		b.WriteString("  (none)\n")
+	}
+	for _, e := range d {
+		switch e.Kind {
+		case DiffAdded:
+			fmt.Fprintf(&b, "  + %s\n", e.Path)
+		case DiffRemoved:
+			fmt.Fprintf(&b, "  - %s\n", e.Path)
+		case DiffChanged:
+			fmt.Fprintf(&b, "  ~ %s\n", e.Path)
+			if e.OldError != e.NewError {
+				fmt.Fprintf(&b, "      error: %q -> %q\n", e.OldError, e.NewError)
+			}
+			for _, v := range e.Output {
+				switch v.Kind {
+				case DiffAdded:
+					fmt.Fprintf(&b, "      + %s: %s\n", outputPath(v.Path), formatJSON(v.New))
+				case DiffRemoved:
+					fmt.Fprintf(&b, "      - %s: %s\n", outputPath(v.Path), formatJSON(v.Old))
+				default:
+					fmt.Fprintf(&b, "      ~ %s: %s -> %s\n", outputPath(v.Path), formatJSON(v.Old), formatJSON(v.New))
+				}
+			}
+		}
+	}
+
+	b.WriteString("Latency:\n")
+	for _, e := range d {
+		if e.Kind == DiffAdded || e.Kind == DiffRemoved {
+			continue
+		}
+		delta := e.LatencyDelta()
+		sign := "+"
+		if delta < 0 {
+			sign, delta = "-", -delta
+		}
+		fmt.Fprintf(&b, "  %s: %s -> %s (%s%s)\n", e.Path, e.OldDuration, e.NewDuration, sign, delta)
+	}
+
+	return b.String()
+}
+
+// indexEvents flattens the event tree into a map keyed by the task path
+// (with the execution order, if needed), along with the ordered keys.
+func indexEvents(event Event) (events map[string]Event, keys []string) {
+	events = make(map[string]Event)
+	counts := make(map[string]int)
+	WalkEvents(event, func(path []string, e Event) {
+		key := strings.Join(path, "/")
+		n := counts[key]
+		counts[key]++
+		if n > 0 {
+			key += "#" + strconv.Itoa(n)
+		}
+		events[key] = e
+		keys = append(keys, key)
+	})
+	return
+}
+
+// DiffValues compares two values structurally, as if they were both encoded
+// into JSON and then decoded back.
+func DiffValues(old, cur any) []ValueDiff {
+	var diffs []ValueDiff
+	diffValues("", normalizeJSON(old), normalizeJSON(cur), &diffs)
+	return diffs
+}
+
+func diffValues(path string, old, cur any, diffs *[]ValueDiff) {
+	oldMap, oldIsMap := old.(map[string]any)
+	newMap, newIsMap := cur.(map[string]any)
+	if oldIsMap && newIsMap {
+		keys := make(map[string]bool)
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		var sortedKeys []string
+		for k := range keys {
+			sortedKeys = append(sortedKeys, k)
+		}
+		sort.Strings(sortedKeys)
+
+		for _, k := range sortedKeys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			o, inOld := oldMap[k]
+			n, inNew := newMap[k]
+			switch {
+			case !inNew:
+				*diffs = append(*diffs, ValueDiff{Path: p, Kind: DiffRemoved, Old: o})
+			case !inOld:
+				*diffs = append(*diffs, ValueDiff{Path: p, Kind: DiffAdded, New: n})
+			default:
+				diffValues(p, o, n, diffs)
+			}
+		}
+		return
+	}
+
+	oldSlice, oldIsSlice := old.([]any)
+	newSlice, newIsSlice := cur.([]any)
+	if oldIsSlice && newIsSlice {
+		for i := 0; i < len(oldSlice) || i < len(newSlice); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(newSlice):
+				*diffs = append(*diffs, ValueDiff{Path: p, Kind: DiffRemoved, Old: oldSlice[i]})
+			case i >= len(oldSlice):
+				*diffs = append(*diffs, ValueDiff{Path: p, Kind: DiffAdded, New: newSlice[i]})
+			default:
+				diffValues(p, oldSlice[i], newSlice[i], diffs)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old, cur) {
+		*diffs = append(*diffs, ValueDiff{Path: path, Kind: DiffChanged, Old: old, New: cur})
+	}
+}
+
+// normalizeJSON converts v into its JSON representation (e.g. all numbers
+// become float64), to make values from different sources comparable.
+func normalizeJSON(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return out
+}
+
+func outputPath(path string) string {
+	switch {
+	case path == "":
+		return "output"
+	case strings.HasPrefix(path, "["):
+		return "output" + path
+	default:
+		return "output." + path
+	}
+}
+
+func formatJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,67 @@
+package orchestrator_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffEvents(t *testing.T) {
+	old := orchestrator.Event{
+		Name:     "flow",
+		Duration: 30 * time.Millisecond,
+		Output:   map[string]any{"result": 42},
+		Events: []orchestrator.Event{
+			{Name: "get", Duration: 10 * time.Millisecond, Output: map[string]any{"body": map[string]any{"items": []any{1, 2}}}},
+			{Name: "loop", Duration: 20 * time.Millisecond, Events: []orchestrator.Event{
+				{Name: "body", Output: map[string]any{"v": 1}},
+				{Name: "body", Output: map[string]any{"v": 2}},
+			}},
+			{Name: "legacy", Output: map[string]any{}},
+		},
+	}
+	new := orchestrator.Event{
+		Name:     "flow",
+		Duration: 25 * time.Millisecond,
+		Error:    fmt.Errorf("oops"),
+		Events: []orchestrator.Event{
+			{Name: "get", Duration: 15 * time.Millisecond, Output: map[string]any{"body": map[string]any{"items": []any{1.0, 3, 4}}}},
+			{Name: "loop", Duration: 20 * time.Millisecond, Events: []orchestrator.Event{
+				{Name: "body", Output: map[string]any{"v": 1}},
+				{Name: "body", Output: map[string]any{"v": 2}},
+			}},
+			{Name: "extra", Output: map[string]any{}},
+		},
+	}
+
+	diff := orchestrator.DiffEvents(old, new)
+
+	want := `Changes:
+  ~ flow
+      error: "" -> "oops"
+      ~ output: {"result":42} -> null
+  ~ flow/get
+      ~ output.body.items[1]: 2 -> 3
+      + output.body.items[2]: 4
+  - flow/legacy
+  + flow/extra
+Latency:
+  flow: 30ms -> 25ms (-5ms)
+  flow/get: 10ms -> 15ms (+5ms)
+  flow/loop: 20ms -> 20ms (+0s)
+  flow/loop/body: 0s -> 0s (+0s)
+  flow/loop/body#1: 0s -> 0s (+0s)
+`
+	if got := diff.String(); got != want {
+		t.Errorf("Want - Got: %s", cmp.Diff(want, got))
+	}
+	if !diff.HasChanges() {
+		t.Errorf("HasChanges: Got (false) != Want (true)")
+	}
+	if orchestrator.DiffEvents(old, old).HasChanges() {
+		t.Errorf("HasChanges: Got (true) != Want (false)")
+	}
+}
@@ -0,0 +1,121 @@
+package orchestrator
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+//go:embed tracereport.html
+var traceReportHTML string
+
+var traceReportTemplate = template.Must(template.New("report").Parse(traceReportHTML))
+
+type reportNode struct {
+	Name     string
+	Type     string
+	Duration time.Duration
+	Error    string
+	Output   string
+	// Class is "failed" if the task failed, or "failed origin" if the task
+	// is where the failure originated (i.e. the deepest failed task).
+	Class    string
+	Children []*reportNode
+
+	// Timeline properties.
+	Indent int
+	Left   string
+	Width  string
+}
+
+// WriteHTMLReport renders the event tree as a self-contained HTML report,
+// which consists of a collapsible task tree, a timeline waterfall and the
+// output/error of each task. The failing path, if any, is highlighted.
+func WriteHTMLReport(w io.Writer, event Event) error {
+	start := event.Start()
+	total := event.Duration
+	WalkEvents(event, func(_ []string, e Event) {
+		// Cover events which are not wrapped in the root's duration (e.g. those
+		// created by AddEvent with no duration).
+		if d := e.When.Sub(start); d > total {
+			total = d
+		}
+	})
+	if total <= 0 {
+		total = 1
+	}
+
+	var rows []*reportNode
+	var build func(e Event, depth int) *reportNode
+	build = func(e Event, depth int) *reportNode {
+		n := &reportNode{
+			Name:     e.Name,
+			Type:     e.Type,
+			Duration: e.Duration,
+			Output:   formatOutput(e.Output),
+			Indent:   depth,
+			Left:     percentage(e.Start().Sub(start), total),
+			Width:    percentage(e.Duration, total),
+		}
+		if e.Error != nil {
+			n.Error = e.Error.Error()
+			n.Class = "failed"
+		}
+		rows = append(rows, n)
+
+		childFailed := false
+		for _, child := range e.Events {
+			c := build(child, depth+1)
+			n.Children = append(n.Children, c)
+			childFailed = childFailed || child.Error != nil
+		}
+		if e.Error != nil && !childFailed {
+			n.Class = "failed origin"
+		}
+		return n
+	}
+	root := build(event, 0)
+
+	status := TraceStatusSucceeded
+	if event.Error != nil {
+		status = TraceStatusFailed
+	}
+
+	return traceReportTemplate.Execute(w, map[string]any{
+		"Root":   root,
+		"Rows":   rows,
+		"Status": status,
+		"Start":  start.Format(traceTimeLayout),
+	})
+}
+
+func formatOutput(output map[string]any) string {
+	if len(output) == 0 {
+		return ""
+	}
+	// No need to escape HTML characters, which will be done by the template.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(output); err != nil {
+		return fmt.Sprintf("%v", output)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func percentage(d, total time.Duration) string {
+	p := float64(d) / float64(total) * 100
+	if p < 0 {
+		p = 0
+	}
+	if p > 100 {
+		p = 100
+	}
+	return fmt.Sprintf("%.2f", p)
+}
@@ -0,0 +1,43 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	flow := builtin.NewSerial("flow").Tasks(
+		builtin.NewFunc("ok").Func(func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+			return orchestrator.Output{"html": "<b>"}, nil
+		}),
+		builtin.NewFunc("fail").Func(func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+			return nil, fmt.Errorf("oops")
+		}),
+	).Build()
+	event := orchestrator.TraceTask(context.Background(), flow, orchestrator.NewInput(nil))
+
+	var buf bytes.Buffer
+	if err := orchestrator.WriteHTMLReport(&buf, event); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		`<title>Trace: flow</title>`,
+		`<b class="status-failed">failed</b>`,
+		`<details class="failed origin" open>`,
+		`<div class="error">oops</div>`,
+		`&#34;html&#34;: &#34;&lt;b&gt;&#34;`,
+		`<div class="bar" style="margin-left: `,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Report: missing %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceStatus string
+
+const (
+	TraceStatusSucceeded TraceStatus = "succeeded"
+	TraceStatusFailed    TraceStatus = "failed"
+)
+
+type TraceOrder string
+
+const (
+	// TraceOrderTime orders records from the newest to the oldest.
+	TraceOrderTime TraceOrder = "time"
+	// TraceOrderDuration orders records from the slowest to the fastest.
+	TraceOrderDuration TraceOrder = "duration"
+)
+
+// TraceRecord is the persisted trace of an execution.
+type TraceRecord struct {
+	ExecutionID string      `json:"execution_id"`
+	Flow        string      `json:"flow"`
+	Status      TraceStatus `json:"status"`
+	Start       time.Time   `json:"start"`
+	End         time.Time   `json:"end"`
+	Event       Event       `json:"event"`
+}
+
+// NewTraceRecord creates a record from the event of an execution.
+func NewTraceRecord(executionID string, event Event) TraceRecord {
+	status := TraceStatusSucceeded
+	if event.Error != nil {
+		status = TraceStatusFailed
+	}
+	return TraceRecord{
+		ExecutionID: executionID,
+		Flow:        event.Name,
+		Status:      status,
+		Start:       event.Start(),
+		End:         event.When,
+		Event:       event,
+	}
+}
+
+// TraceQuery specifies the criteria for querying trace records. Zero-valued
+// fields are ignored.
+type TraceQuery struct {
+	Flow   string
+	Status TraceStatus
+	// Records started within [Since, Until).
+	Since time.Time
+	Until time.Time
+
+	// Task selects records which contain the given task. Task can be either
+	// a task name or a task path (e.g. "get_todo_user/get_user"). If specified,
+	// the duration used for ordering will be the task's duration instead of
+	// the execution's.
+	Task string
+
+	// OrderBy defaults to TraceOrderTime.
+	OrderBy TraceOrder
+	// The maximum number of records to return. Zero means no limit.
+	Limit int
+}
+
+// TraceStore persists the traces of executions.
+type TraceStore interface {
+	// Save saves a record.
+	Save(ctx context.Context, record TraceRecord) error
+
+	// Get returns the record of the given execution.
+	Get(ctx context.Context, executionID string) (TraceRecord, error)
+
+	// Query returns the records matching the given query.
+	Query(ctx context.Context, query TraceQuery) ([]TraceRecord, error)
+}
+
+type traceStoreKey struct{}
+
+// ContextWithTraceStore returns a copy of ctx which carries the trace store.
+// Traced executions (see TraceTask) will then be saved into the store.
+func ContextWithTraceStore(ctx context.Context, store TraceStore) context.Context {
+	return context.WithValue(ctx, traceStoreKey{}, store)
+}
+
+// TraceStoreFromContext returns the trace store carried by ctx, if any.
+func TraceStoreFromContext(ctx context.Context) TraceStore {
+	store, _ := ctx.Value(traceStoreKey{}).(TraceStore)
+	return store
+}
+
+// SaveTrace saves the event of an execution into the trace store carried
+// by ctx. It does nothing if there is no trace store.
+func SaveTrace(ctx context.Context, event Event) error {
+	store := TraceStoreFromContext(ctx)
+	if store == nil {
+		return nil
+	}
+
+	id := ExecutionIDFromContext(ctx)
+	if id == "" {
+		id = NewExecutionID()
+	}
+	return store.Save(ctx, NewTraceRecord(id, event))
+}
+
+// MemoryTraceStore is an in-memory trace store.
+//
+// Records are indexed by execution ID, and by flow and status (along with any
+// combination of them). All indexes are ordered by start time, so a time range
+// is located by binary search. Only the Task criterion requires scanning the
+// events of the records which match the other criteria.
+type MemoryTraceStore struct {
+	mu    sync.RWMutex
+	byID  map[string]*TraceRecord
+	index map[traceIndexKey][]*TraceRecord
+}
+
+// traceIndexKey is the key of an index, in which empty fields match any value.
+type traceIndexKey struct {
+	flow   string
+	status TraceStatus
+}
+
+func NewMemoryTraceStore() *MemoryTraceStore {
+	return &MemoryTraceStore{
+		byID:  make(map[string]*TraceRecord),
+		index: make(map[traceIndexKey][]*TraceRecord),
+	}
+}
+
+func (s *MemoryTraceStore) Save(ctx context.Context, record TraceRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byID[record.ExecutionID]; ok {
+		return fmt.Errorf("trace of execution %q already exists", record.ExecutionID)
+	}
+
+	r := &record
+	s.byID[r.ExecutionID] = r
+	for _, key := range []traceIndexKey{
+		{},
+		{flow: r.Flow},
+		{status: r.Status},
+		{flow: r.Flow, status: r.Status},
+	} {
+		s.index[key] = insertByStart(s.index[key], r)
+	}
+	return nil
+}
+
+func (s *MemoryTraceStore) Get(ctx context.Context, executionID string) (TraceRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.byID[executionID]
+	if !ok {
+		return TraceRecord{}, fmt.Errorf("trace of execution %q is not found", executionID)
+	}
+	return *r, nil
+}
+
+func (s *MemoryTraceStore) Query(ctx context.Context, query TraceQuery) ([]TraceRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates := s.index[traceIndexKey{flow: query.Flow, status: query.Status}]
+
+	// Narrow down the candidates to those started within [Since, Until).
+	lo, hi := 0, len(candidates)
+	if !query.Since.IsZero() {
+		lo = sort.Search(len(candidates), func(i int) bool {
+			return !candidates[i].Start.Before(query.Since)
+		})
+	}
+	if !query.Until.IsZero() {
+		hi = sort.Search(len(candidates), func(i int) bool {
+			return !candidates[i].Start.Before(query.Until)
+		})
+	}
+	if lo > hi {
+		lo = hi
+	}
+	candidates = candidates[lo:hi]
+
+	type match struct {
+		record   *TraceRecord
+		duration time.Duration
+	}
+	var matches []match
+
+	// Iterate from the newest to the oldest.
+	for i := len(candidates) - 1; i >= 0; i-- {
+		r := candidates[i]
+		duration := r.Event.Duration
+		if query.Task != "" {
+			d, ok := findTaskDuration(r.Event, query.Task)
+			if !ok {
+				continue
+			}
+			duration = d
+		}
+		matches = append(matches, match{record: r, duration: duration})
+	}
+
+	switch query.OrderBy {
+	case "", TraceOrderTime:
+		// Already ordered.
+	case TraceOrderDuration:
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].duration > matches[j].duration
+		})
+	default:
+		return nil, fmt.Errorf("bad order %q", query.OrderBy)
+	}
+
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+	}
+
+	records := make([]TraceRecord, len(matches))
+	for i, m := range matches {
+		records[i] = *m.record
+	}
+	return records, nil
+}
+
+func insertByStart(records []*TraceRecord, r *TraceRecord) []*TraceRecord {
+	i := sort.Search(len(records), func(i int) bool {
+		return records[i].Start.After(r.Start)
+	})
+	records = append(records, nil)
+	copy(records[i+1:], records[i:])
+	records[i] = r
+	return records
+}
+
+// findTaskDuration returns the longest duration of the given task (name or
+// path) within the event tree.
+func findTaskDuration(event Event, task string) (duration time.Duration, found bool) {
+	byPath := strings.Contains(task, "/")
+	WalkEvents(event, func(path []string, e Event) {
+		matched := e.Name == task
+		if byPath {
+			matched = strings.Join(path, "/") == task
+		}
+		if matched && (!found || e.Duration > duration) {
+			duration, found = e.Duration, true
+		}
+	})
+	return
+}
+
+// WalkEvents calls f for the given event and all its descendant events in
+// depth-first order, along with the task path of each event.
+func WalkEvents(event Event, f func(path []string, e Event)) {
+	walkEvents(nil, event, f)
+}
+
+func walkEvents(parent []string, event Event, f func(path []string, e Event)) {
+	path := append(parent[:len(parent):len(parent)], event.Name)
+	f(path, event)
+	for _, e := range event.Events {
+		walkEvents(path, e, f)
+	}
+}
+
+// FileTraceStore is a trace store backed by a JSONL file, in which each line
+// is a record. All records are also indexed in memory.
+type FileTraceStore struct {
+	*MemoryTraceStore
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileTraceStore opens (or creates) the file at the given path, and loads
+// all the existing records from it.
+func NewFileTraceStore(path string) (*FileTraceStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileTraceStore{
+		MemoryTraceStore: NewMemoryTraceStore(),
+		file:             file,
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var record TraceRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to load trace record: %v", err)
+		}
+		if err := s.MemoryTraceStore.Save(context.Background(), record); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileTraceStore) Save(ctx context.Context, record TraceRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.MemoryTraceStore.Get(ctx, record.ExecutionID); err == nil {
+		return fmt.Errorf("trace of execution %q already exists", record.ExecutionID)
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.MemoryTraceStore.Save(ctx, record)
+}
+
+// Close closes the underlying file.
+func (s *FileTraceStore) Close() error {
+	return s.file.Close()
+}
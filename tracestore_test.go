@@ -0,0 +1,123 @@
+package orchestrator_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/orchestrator"
+	"github.com/RussellLuo/orchestrator/builtin"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newSleepFlow(name string, sleep time.Duration, fail bool) orchestrator.Task {
+	return builtin.NewSerial(name).Tasks(
+		builtin.NewFunc("sleep").Func(func(context.Context, orchestrator.Input) (orchestrator.Output, error) {
+			time.Sleep(sleep)
+			if fail {
+				return nil, fmt.Errorf("oops")
+			}
+			return orchestrator.Output{"slept": sleep.String()}, nil
+		}),
+	).Build()
+}
+
+func TestTraceStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	fileStore, err := orchestrator.NewFileTraceStore(path)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	for _, store := range []orchestrator.TraceStore{orchestrator.NewMemoryTraceStore(), fileStore} {
+		ctx := orchestrator.ContextWithTraceStore(context.Background(), store)
+		runs := []struct {
+			id   string
+			flow orchestrator.Task
+		}{
+			{"1", newSleepFlow("a", 1*time.Millisecond, false)},
+			{"2", newSleepFlow("a", 20*time.Millisecond, true)},
+			{"3", newSleepFlow("b", 1*time.Millisecond, true)},
+			{"4", newSleepFlow("a", 10*time.Millisecond, false)},
+		}
+		for _, r := range runs {
+			orchestrator.TraceTask(orchestrator.ContextWithExecutionID(ctx, r.id), r.flow, orchestrator.NewInput(nil))
+		}
+		second, _ := store.Get(ctx, "2")
+		fourth, _ := store.Get(ctx, "4")
+
+		tests := []struct {
+			name    string
+			inQuery orchestrator.TraceQuery
+			wantIDs []string
+		}{
+			{
+				name:    "all",
+				inQuery: orchestrator.TraceQuery{},
+				wantIDs: []string{"4", "3", "2", "1"},
+			},
+			{
+				name:    "failed runs of flow",
+				inQuery: orchestrator.TraceQuery{Flow: "a", Status: orchestrator.TraceStatusFailed},
+				wantIDs: []string{"2"},
+			},
+			{
+				name:    "failed runs within time range",
+				inQuery: orchestrator.TraceQuery{Status: orchestrator.TraceStatusFailed, Since: second.Start, Until: fourth.Start},
+				wantIDs: []string{"3", "2"},
+			},
+			{
+				name:    "runs of flow since time",
+				inQuery: orchestrator.TraceQuery{Flow: "a", Since: fourth.Start},
+				wantIDs: []string{"4"},
+			},
+			{
+				name:    "slowest executions of task",
+				inQuery: orchestrator.TraceQuery{Task: "a/sleep", OrderBy: orchestrator.TraceOrderDuration, Limit: 2},
+				wantIDs: []string{"2", "4"},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%T/%s", store, tt.name), func(t *testing.T) {
+				records, err := store.Query(context.Background(), tt.inQuery)
+				if err != nil {
+					t.Fatalf("Err: %v", err)
+				}
+				var gotIDs []string
+				for _, r := range records {
+					gotIDs = append(gotIDs, r.ExecutionID)
+				}
+				if !cmp.Equal(gotIDs, tt.wantIDs) {
+					t.Errorf("Want - Got: %s", cmp.Diff(tt.wantIDs, gotIDs))
+				}
+			})
+		}
+	}
+
+	if err := fileStore.Close(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	// Reopen the file store to check the persisted records.
+	fileStore, err = orchestrator.NewFileTraceStore(path)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	defer fileStore.Close()
+
+	record, err := fileStore.Get(context.Background(), "2")
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if record.Flow != "a" || record.Status != orchestrator.TraceStatusFailed {
+		t.Fatalf("Record: Got (%s, %s)", record.Flow, record.Status)
+	}
+	if got := record.Event.Events[0].Error; got == nil || got.Error() != "oops" {
+		t.Fatalf("Error: Got (%v) != Want (oops)", got)
+	}
+	if record.Event.Events[0].Duration < 20*time.Millisecond {
+		t.Fatalf("Duration: Got (%s) < Want (20ms)", record.Event.Events[0].Duration)
+	}
+}